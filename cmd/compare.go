@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newCompareCmd(o *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "compare <a> <b>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Decode and diff user data of two files",
+		Long: `Decode and diff user data of two files, e.g. the user data of a running instance and the one in git.
+Each file can hold base64 or gzip encoded user data, a MIME document, a plain script or cloud-config, or the
+output of 'aws ec2 describe-instance-attribute --attribute userData'; the encoding is detected for each file.`,
+		Example: `  aws ec2 describe-instance-attribute --instance-id i-0123456789abcdef0 --attribute userData > running.json
+  diffdecoding compare running.json user-data.mime`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.compare(cmd, args[0], args[1])
+		},
+	}
+}
+
+func (o *rootOptions) compare(cmd *cobra.Command, fileA, fileB string) error {
+	d, err := o.newDiff(cmd)
+	if err != nil {
+		return err
+	}
+	a, err := os.ReadFile(fileA)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(fileB)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	res, err := d.DiffUserData(a, b)
+	if err == nil {
+		err = d.RenderResult(&buf, res)
+	}
+	if err == nil {
+		err = d.CheckResult(res)
+	}
+	return o.writeOutput(cmd, &buf, err)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	dir := t.TempDir()
+	running := filepath.Join(dir, "running.json")
+	script := filepath.Join(dir, "user-data.sh")
+	output := filepath.Join(dir, "diff.txt")
+	value := base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\necho one\n"))
+	assert.NoError(t, os.WriteFile(running, []byte(`{"UserData": {"Value": "`+value+`"}}`), 0644))
+	assert.NoError(t, os.WriteFile(script, []byte("#!/bin/bash\necho two\n"), 0644))
+
+	_, err := executeCommand(t, newRootCmd(), "compare", running, script, "--config", os.DevNull, "--format", "summary", "--no-color", "-o", output)
+	assert.NoError(t, err)
+	b, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, " text/x-shellscript | 2 +-\n 1 part changed, 1 insertion(+), 1 deletion(-)", string(b))
+}
+
+func TestCompare_Args(t *testing.T) {
+	output, err := executeCommand(t, newRootCmd(), "compare", "a")
+	assert.Error(t, err)
+	checkStringContains(t, output, "compare <a> <b>")
+}
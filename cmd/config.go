@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	diff "github.com/meoconbatu/diffdecoding/lib"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the name of the configuration file searched in the
+// working directory and its parents.
+const configFileName = ".diffdecoding.yaml"
+
+// envPrefix is the prefix of environment variables overriding flags, e.g.
+// DIFFDECODING_FORMAT for --format.
+const envPrefix = "DIFFDECODING_"
+
+// settings are the values of the configuration file, or of one of its profiles.
+type settings struct {
+	Format           *string `yaml:"format"`
+	NoColor          *bool   `yaml:"no_color"`
+	Context          *int    `yaml:"context"`
+	CommentSizeLimit *int    `yaml:"comment_size_limit"`
+	Strict           *bool   `yaml:"strict"`
+	Binary           *string `yaml:"binary"`
+	CertExpiryDays   *int    `yaml:"cert_expiry_days"`
+	Redact           *struct {
+		Disabled *bool    `yaml:"disabled"`
+		Patterns []string `yaml:"patterns"`
+	} `yaml:"redact"`
+	// Resources maps resource types to their user data argument.
+	Resources  map[string]string `yaml:"resources"`
+	Ignore     []ignoreSettings  `yaml:"ignore"`
+	IgnoreFile *string           `yaml:"ignore_file"`
+	// Policy is the path of a policy file, or a policy with inline rules.
+	Policy yaml.Node `yaml:"policy"`
+}
+
+// ignoreSettings is an ignore rule, see diff.IgnoreRule.
+type ignoreSettings struct {
+	Resource string   `yaml:"resource"`
+	Part     string   `yaml:"part"`
+	Path     string   `yaml:"path"`
+	Lines    []string `yaml:"lines"`
+}
+
+// config is the content of a configuration file.
+type config struct {
+	settings `yaml:",inline"`
+	// Profiles holds named settings, applied over the top-level ones with --profile.
+	Profiles map[string]settings `yaml:"profiles"`
+	// dir is the directory of the file, relative paths are resolved against it.
+	dir string
+}
+
+// applyConfig sets the flags that are not set on the command line, first from
+// environment variables (DIFFDECODING_<FLAG>), then from the configuration
+// file, with the settings of the selected profile over the top-level ones.
+// It returns the configuration, whose settings without a flag are used as is.
+func applyConfig(flags *pflag.FlagSet) (*config, error) {
+	if err := applyEnv(flags); err != nil {
+		return nil, err
+	}
+	configFile, _ := flags.GetString("config")
+	profile, _ := flags.GetString("profile")
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
+	cfg := &config{}
+	if configFile != "" {
+		var err error
+		if cfg, err = loadConfig(configFile); err != nil {
+			return nil, err
+		}
+	}
+	if profile != "" {
+		p, ok := cfg.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q", profile)
+		}
+		cfg.merge(p)
+	}
+	return cfg, cfg.applyFlags(flags)
+}
+
+// applyEnv sets the flags that are not set on the command line from environment variables.
+func applyEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(name); ok && !f.Changed && err == nil {
+			if setErr := flags.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("%s: %w", name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// findConfigFile returns the path of the closest configFileName in the working
+// directory or its parents, "" if there is none.
+func findConfigFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		name := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func loadConfig(fileName string) (*config, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{dir: filepath.Dir(fileName)}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return cfg, nil
+}
+
+// merge applies the settings of a profile over the top-level ones: values
+// replace the top-level ones, except resources and ignore rules which are added.
+func (c *config) merge(p settings) {
+	if p.Format != nil {
+		c.Format = p.Format
+	}
+	if p.NoColor != nil {
+		c.NoColor = p.NoColor
+	}
+	if p.Context != nil {
+		c.Context = p.Context
+	}
+	if p.CommentSizeLimit != nil {
+		c.CommentSizeLimit = p.CommentSizeLimit
+	}
+	if p.Strict != nil {
+		c.Strict = p.Strict
+	}
+	if p.Binary != nil {
+		c.Binary = p.Binary
+	}
+	if p.CertExpiryDays != nil {
+		c.CertExpiryDays = p.CertExpiryDays
+	}
+	if p.Redact != nil {
+		c.Redact = p.Redact
+	}
+	if p.IgnoreFile != nil {
+		c.IgnoreFile = p.IgnoreFile
+	}
+	if p.Policy.Kind != 0 {
+		c.Policy = p.Policy
+	}
+	if len(p.Resources) > 0 && c.Resources == nil {
+		c.Resources = make(map[string]string)
+	}
+	for typ, arg := range p.Resources {
+		c.Resources[typ] = arg
+	}
+	c.Ignore = append(c.Ignore, p.Ignore...)
+}
+
+// applyFlags sets the flags that are not set yet from the settings.
+func (c *config) applyFlags(flags *pflag.FlagSet) error {
+	values := make(map[string][]string)
+	if c.Format != nil {
+		values["format"] = []string{*c.Format}
+	}
+	if c.NoColor != nil {
+		values["no-color"] = []string{strconv.FormatBool(*c.NoColor)}
+	}
+	if c.Context != nil {
+		values["context"] = []string{strconv.Itoa(*c.Context)}
+	}
+	if c.CommentSizeLimit != nil {
+		values["comment-size-limit"] = []string{strconv.Itoa(*c.CommentSizeLimit)}
+	}
+	if c.Strict != nil {
+		values["strict"] = []string{strconv.FormatBool(*c.Strict)}
+	}
+	if c.Binary != nil {
+		values["binary"] = []string{*c.Binary}
+	}
+	if c.CertExpiryDays != nil {
+		values["cert-expiry-days"] = []string{strconv.Itoa(*c.CertExpiryDays)}
+	}
+	if c.Redact != nil {
+		if c.Redact.Disabled != nil {
+			values["no-redact"] = []string{strconv.FormatBool(*c.Redact.Disabled)}
+		}
+		values["redact-pattern"] = c.Redact.Patterns
+	}
+	if c.IgnoreFile != nil {
+		values["ignore-file"] = []string{c.path(*c.IgnoreFile)}
+	}
+	if c.Policy.Kind == yaml.ScalarNode {
+		values["policy"] = []string{c.path(c.Policy.Value)}
+	}
+	for name, vs := range values {
+		if flags.Changed(name) {
+			continue
+		}
+		for _, v := range vs {
+			if err := flags.Set(name, v); err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// path resolves name against the directory of the configuration file.
+func (c *config) path(name string) string {
+	if filepath.IsAbs(name) || c.dir == "" {
+		return name
+	}
+	return filepath.Join(c.dir, name)
+}
+
+// ignoreRules returns the ignore rules of the configuration.
+func (c *config) ignoreRules() ([]diff.IgnoreRule, error) {
+	rules := make([]diff.IgnoreRule, 0)
+	for _, s := range c.Ignore {
+		for _, line := range s.Lines {
+			re, err := regexp.Compile(line)
+			if err != nil {
+				return nil, fmt.Errorf("config: ignore: %w", err)
+			}
+			rules = append(rules, diff.IgnoreRule{Resource: s.Resource, Part: s.Part, Path: s.Path, Lines: re})
+		}
+	}
+	return rules, nil
+}
+
+// policy returns the policy of the configuration if its rules are inline, nil otherwise.
+func (c *config) policy() (*diff.Policy, error) {
+	if c.Policy.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	b, err := yaml.Marshal(&c.Policy)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := diff.LoadPolicy(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("config: policy: %w", err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+format: markdown
+context: 2
+resources:
+  my_vm: boot_script
+redact:
+  patterns: ['license=(\w+)']
+ignore:
+- resource: module.app.*
+  lines: ['^BUILD_ID=']
+policy:
+  rules:
+  - name: sudoers
+    path: /etc/sudoers.d/*
+profiles:
+  ci:
+    format: github-annotations
+    no_color: true
+  local:
+    context: 5
+`
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, configFileName)
+	assert.NoError(t, os.WriteFile(configFile, []byte(testConfig), 0644))
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		format  string
+		context int
+		noColor bool
+	}{
+		{"config", []string{"--config", configFile}, nil, "markdown", 2, false},
+		{"profile", []string{"--config", configFile, "--profile", "ci"}, nil, "github-annotations", 2, true},
+		{"env over config", []string{"--config", configFile}, map[string]string{"DIFFDECODING_PROFILE": "local", "DIFFDECODING_CONTEXT": "3"}, "markdown", 3, false},
+		{"flag over env", []string{"--config", configFile, "--context", "1"}, map[string]string{"DIFFDECODING_CONTEXT": "3"}, "markdown", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cmd := newRootCmd()
+			assert.NoError(t, cmd.ParseFlags(tt.args))
+			cfg, err := applyConfig(cmd.Flags())
+			assert.NoError(t, err)
+			format, _ := cmd.Flags().GetString("format")
+			context, _ := cmd.Flags().GetInt("context")
+			noColor, _ := cmd.Flags().GetBool("no-color")
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.context, context)
+			assert.Equal(t, tt.noColor, noColor)
+			assert.Equal(t, map[string]string{"my_vm": "boot_script"}, cfg.Resources)
+
+			patterns, _ := cmd.Flags().GetStringArray("redact-pattern")
+			assert.Equal(t, []string{`license=(\w+)`}, patterns)
+			rules, err := cfg.ignoreRules()
+			assert.NoError(t, err)
+			assert.Len(t, rules, 1)
+			policy, err := cfg.policy()
+			assert.NoError(t, err)
+			assert.Len(t, policy.Rules, 1)
+		})
+	}
+}
+
+func TestApplyConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, configFileName)
+	assert.NoError(t, os.WriteFile(configFile, []byte("formats: html\n"), 0644))
+	cmd := newRootCmd()
+	assert.NoError(t, cmd.ParseFlags([]string{"--config", configFile}))
+	_, err := applyConfig(cmd.Flags())
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(configFile, []byte(testConfig), 0644))
+	cmd = newRootCmd()
+	assert.NoError(t, cmd.ParseFlags([]string{"--config", configFile, "--profile", "prod"}))
+	_, err = applyConfig(cmd.Flags())
+	assert.EqualError(t, err, `unknown profile "prod"`)
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "modules", "app")
+	assert.NoError(t, os.MkdirAll(sub, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, configFileName), []byte(testConfig), 0644))
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Chdir(sub))
+	found, _ := filepath.EvalSymlinks(findConfigFile())
+	expect, _ := filepath.EvalSymlinks(filepath.Join(dir, configFileName))
+	assert.Equal(t, expect, found)
+}
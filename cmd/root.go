@@ -11,61 +11,189 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	diff "github.com/meoconbatu/diffdecoding/lib"
 
 	"github.com/spf13/cobra"
 )
 
-var (
+var version = "dev"
+
+// rootOptions holds the flags of the root command.
+type rootOptions struct {
 	iFile, oFile string
 	iJsonFile    string
+	configFile   string
+	profile      string
 	noColor      bool
-	version      = "dev"
-)
+	effective    bool
+	noRedact     bool
+	showSecret   bool
+	redactRegexs []string
+	redactKey    string
+	policyFile   string
+	noValidate   bool
+	showSizes    bool
+	failOnLimit  bool
+	strict       bool
+	binary       string
+	certExpiry   int
+	context      int
+	format       string
+	commentLimit int
+	stat         bool
+	summary      bool
+	filter       diff.Filter
+	ignoreFile   string
+}
 
 // rootCmd represents the base command when called without any subcommands
-var rootCmd = &cobra.Command{
-	Use:   "diffdecoding",
-	Args:  cobra.NoArgs,
-	Short: "diffdecoding is a tool to decode and diff value in user_data_base64 attribute on aws_instance, generated by 'terraform plan'.",
-	Long: `diffdecoding is a tool to decode and diff value in user_data_base64 attribute on aws_instance, generated by 'terraform plan'.
+var rootCmd = newRootCmd()
+
+func newRootCmd() *cobra.Command {
+	o := &rootOptions{}
+	cmd := &cobra.Command{
+		Use:   "diffdecoding",
+		Args:  cobra.NoArgs,
+		Short: "diffdecoding is a tool to decode and diff value in user_data_base64 attribute on aws_instance, generated by 'terraform plan'.",
+		Long: `diffdecoding is a tool to decode and diff value in user_data_base64 attribute on aws_instance, generated by 'terraform plan'.
 If values are rendered from cloud-init data source, decode encoded content (if exists) before diff.`,
-	Version: version,
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if iFile == "" && iJsonFile == "" {
-			return errors.New("must set one flags in the group [input json]; none of [input json] were set")
-		}
-		return nil
-	},
-	RunE: rootCmdExec,
+		Version: version,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if o.iFile == "" && o.iJsonFile == "" {
+				return errors.New("must set one flags in the group [input json]; none of [input json] were set")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd)
+		},
+	}
+	o.addFlags(cmd)
+	cmd.AddCommand(newCompareCmd(o))
+	return cmd
 }
 
-func rootCmdExec(cmd *cobra.Command, args []string) error {
+func (o *rootOptions) run(cmd *cobra.Command) error {
 	var buf bytes.Buffer
-	var err error
-	d := diff.New()
-	if iFile != "" {
-		err = diffFn(iFile, &buf, d.PlanChange)
-	} else if iJsonFile != "" {
-		err = diffFn(iJsonFile, &buf, d.PlanJSON)
+	d, err := o.newDiff(cmd)
+	if err != nil {
+		return err
+	}
+	if o.iFile != "" {
+		err = o.diffFn(o.iFile, &buf, d.PlanChange)
+	} else if o.iJsonFile != "" {
+		err = o.diffFn(o.iJsonFile, &buf, d.PlanJSON)
+	}
+	return o.writeOutput(cmd, &buf, err)
+}
+
+// newDiff returns a Diff configured by the flags, then the environment and
+// the configuration file, see applyConfig.
+func (o *rootOptions) newDiff(cmd *cobra.Command) (*diff.Diff, error) {
+	cfg, err := applyConfig(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	opts := diff.Options{
+		NoColor:          o.noColor,
+		Context:          o.context,
+		Format:           o.format,
+		CommentSizeLimit: o.commentLimit,
+		EffectiveContent: o.effective,
+		ShowSensitive:    o.showSecret,
+		NoRedact:         o.noRedact,
+		RedactPatterns:   o.redactRegexs,
+		RedactKey:        o.redactKey,
+		NoValidate:       o.noValidate,
+		ShowSizes:        o.showSizes,
+		FailOnSizeLimit:  o.failOnLimit,
+		Strict:           o.strict,
+		Binary:           o.binary,
+		CertExpiryDays:   o.certExpiry,
+		Filter:           o.filter,
+		ResourceArgs:     cfg.Resources,
+	}
+	if o.stat {
+		opts.Format = "stat"
+	} else if o.summary {
+		opts.Format = "summary"
+	}
+	opts.Ignore, err = loadIgnore(o.ignoreFile, cmd.Flags().Changed("ignore-file"))
+	if err != nil {
+		return nil, err
+	}
+	rules, err := cfg.ignoreRules()
+	if err != nil {
+		return nil, err
+	}
+	opts.Ignore = append(opts.Ignore, rules...)
+	if o.policyFile != "" {
+		opts.Policy, err = loadPolicy(o.policyFile)
+	} else {
+		opts.Policy, err = cfg.policy()
 	}
 	if err != nil {
+		return nil, err
+	}
+	return diff.NewWithOptions(opts)
+}
+
+// writeOutput writes buf to the output file or stdout, unless err is an error
+// other than policy violations, size limits or decode diagnostics, which are reported with the diff.
+func (o *rootOptions) writeOutput(cmd *cobra.Command, buf *bytes.Buffer, err error) error {
+	// policy violations, size limits and decode diagnostics are written with
+	// the diff, so these errors only set the exit status once the output is written
+	var policyErr *diff.PolicyError
+	var sizeErr *diff.SizeLimitError
+	var decodeErr *diff.DecodeError
+	reported := errors.As(err, &policyErr) || errors.As(err, &sizeErr) || errors.As(err, &decodeErr)
+	if err != nil && !reported {
 		return err
 	}
-	if oFile != "" {
-		os.WriteFile(oFile, buf.Bytes(), 0644)
+	if o.oFile != "" {
+		os.WriteFile(o.oFile, buf.Bytes(), 0644)
 	} else {
 		fmt.Fprint(os.Stdout, buf.String())
 	}
+	if reported {
+		cmd.SilenceUsage = true
+		return err
+	}
 	return nil
 }
-func diffFn(fileName string, w io.Writer, fn func(r io.Reader, w io.Writer, noColor bool) error) error {
+func loadPolicy(fileName string) (*diff.Policy, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return diff.LoadPolicy(f)
+}
+
+// loadIgnore reads the ignore rules of fileName; a missing file is an error only if it was set explicitly.
+func loadIgnore(fileName string, explicit bool) ([]diff.IgnoreRule, error) {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := diff.LoadIgnore(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return rules, nil
+}
+func (o *rootOptions) diffFn(fileName string, w io.Writer, fn func(r io.Reader, w io.Writer) error) error {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return err
 	}
-	return fn(bufio.NewReader(f), w, noColor)
+	return fn(bufio.NewReader(f), w)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -74,15 +202,43 @@ func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
 }
 
-func init() {
-	rootCmdFlags(rootCmd)
-}
-
-func rootCmdFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&iFile, "input", "i", "", "Read input from the given path")
-	cmd.Flags().StringVar(&iJsonFile, "json", "", "Read input json from the given path")
+func (o *rootOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.iFile, "input", "i", "", "Read input from the given path")
+	cmd.Flags().StringVar(&o.iJsonFile, "json", "", "Read input json from the given path")
 	cmd.MarkFlagsMutuallyExclusive("input", "json")
 
-	cmd.Flags().StringVarP(&oFile, "output", "o", "", "Write output to the given path. If not specified, print output to console")
-	cmd.Flags().BoolVar(&noColor, "no-color", false, "If specified, output won't contain any color")
+	// flags shared with subcommands
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&o.configFile, "config", "", "Read settings from the given YAML file; if not specified, "+configFileName+" is searched in the working directory and its parents")
+	flags.StringVar(&o.profile, "profile", "", "Apply the settings of the given profile of the configuration file")
+	flags.StringVarP(&o.oFile, "output", "o", "", "Write output to the given path. If not specified, print output to console")
+	flags.BoolVar(&o.noColor, "no-color", false, "If specified, output won't contain any color")
+	flags.StringVar(&o.format, "format", "text", "Output format, one of: "+strings.Join(diff.Formats(), ", "))
+	flags.BoolVar(&o.stat, "stat", false, "If specified, show the number of inserted and deleted lines per resource, part and write_files path, like 'git diff --stat'")
+	flags.BoolVar(&o.summary, "summary", false, "If specified, show the number of inserted and deleted lines per resource")
+	cmd.MarkFlagsMutuallyExclusive("format", "stat", "summary")
+	flags.IntVar(&o.commentLimit, "comment-size-limit", 65536, "Maximum size in bytes of the markdown format, resources over it are left out with a notice; 0 disables the limit")
+	flags.IntVar(&o.context, "context", 0, "Number of unchanged lines shown around changed lines; if 0, unchanged lines are shown as '...'")
+	flags.BoolVar(&o.showSecret, "show-sensitive", false, "If specified, decode and diff values marked sensitive in the plan instead of showing '(sensitive value)'")
+	flags.BoolVar(&o.noRedact, "no-redact", false, "If specified, secrets in decoded content (private keys, AWS access keys, passwords, tokens) are shown in clear text")
+	flags.StringArrayVar(&o.redactRegexs, "redact-pattern", nil, "Regular expression of an additional secret to redact; if it has a capturing group, only the group is redacted. Can be repeated")
+	flags.StringVar(&o.redactKey, "redact-key", "", "Key of the hash in redaction markers, best set from a secret with DIFFDECODING_REDACT_KEY; defaults to a public key, stable across runs")
+	cmd.MarkFlagsMutuallyExclusive("no-redact", "redact-pattern")
+	flags.StringVar(&o.policyFile, "policy", "", "Check changes against the rules in the given YAML file; exit with a non-zero status if a rule of severity error matches")
+	flags.BoolVar(&o.noValidate, "no-validate", false, "If specified, cloud-config parts are not validated against the bundled subset of cloud-init's schema")
+	flags.BoolVar(&o.showSizes, "sizes", false, "If specified, show the raw, gzip and base64 sizes of user data before and after")
+	flags.BoolVar(&o.failOnLimit, "fail-on-size-limit", false, "If specified, exit with a non-zero status when user data is over the provider size limit")
+	flags.StringVar(&o.binary, "binary", diff.BinarySummary, "How binary content is compared, one of: "+diff.BinarySummary+" (MIME type, size and SHA-256), "+diff.BinaryHex+" (hexdump of changed regions)")
+	flags.IntVar(&o.certExpiry, "cert-expiry-days", 30, "Number of days before expiry a certificate in decoded content is reported as expiring")
+	flags.BoolVar(&o.strict, "strict", false, "If specified, exit with a non-zero status when write_files content after the change doesn't decode as declared by its encoding; unknown encodings are only reported")
+	flags.StringArrayVar(&o.filter.Resources, "resource", nil, "Only diff resources whose address matches the given glob, e.g. 'module.app.*'. Can be repeated")
+	flags.StringArrayVar(&o.filter.ExcludeResources, "exclude-resource", nil, "Don't diff resources whose address matches the given glob. Can be repeated")
+	flags.StringArrayVar(&o.filter.Types, "type", nil, "Only diff resources of the given type, e.g. 'aws_launch_template'. Can be repeated")
+	flags.StringArrayVar(&o.filter.ExcludeTypes, "exclude-type", nil, "Don't diff resources of the given type. Can be repeated")
+	flags.StringArrayVar(&o.filter.Parts, "part", nil, "Only diff MIME parts whose file name or Content-Type matches the given glob. Can be repeated")
+	flags.StringArrayVar(&o.filter.ExcludeParts, "exclude-part", nil, "Don't diff MIME parts whose file name or Content-Type matches the given glob. Can be repeated")
+	flags.StringArrayVar(&o.filter.Paths, "path", nil, "Only diff write_files entries whose path matches the given glob; other parts are left out. Can be repeated")
+	flags.StringArrayVar(&o.filter.ExcludePaths, "exclude-path", nil, "Don't diff write_files entries whose path matches the given glob. Can be repeated")
+	flags.StringVar(&o.ignoreFile, "ignore-file", ".diffdecodingignore", "Drop lines matching the regular expressions of the given file before diffing")
+	flags.BoolVar(&o.effective, "effective", false, "If specified, merge write_files entries sharing a path (applying 'append') and diff the resulting file content")
 }
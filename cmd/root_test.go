@@ -18,14 +18,14 @@ func executeCommand(t *testing.T, cmd *cobra.Command, args ...string) (string, e
 	return strings.TrimSpace(buf.String()), err
 }
 func TestPrintHelpWhenNoArgs(t *testing.T) {
-	output, err := executeCommand(t, rootCmd)
+	output, err := executeCommand(t, newRootCmd())
 	if err == nil {
 		t.Errorf("Expected error")
 	}
 	checkStringContains(t, output, "[flags]")
 }
 func TestPrintUsageWhenUnknownSubCommand(t *testing.T) {
-	output, err := executeCommand(t, rootCmd, []string{"unknown"}...)
+	output, err := executeCommand(t, newRootCmd(), []string{"unknown"}...)
 	if err == nil {
 		t.Errorf("Expected error")
 	}
@@ -33,7 +33,7 @@ func TestPrintUsageWhenUnknownSubCommand(t *testing.T) {
 
 }
 func TestRequiredFlagMutuallyExclusive(t *testing.T) {
-	output, err := executeCommand(t, rootCmd, []string{"--input", "file1", "--json", "file2"}...)
+	output, err := executeCommand(t, newRootCmd(), []string{"--input", "file1", "--json", "file2"}...)
 	if err == nil {
 		t.Errorf("Expected error")
 	}
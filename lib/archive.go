@@ -0,0 +1,192 @@
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// archiveSeparator separates the path of an archive from the name of its
+// members, e.g. /opt/bundle.tar.gz!/bin/start.sh
+const archiveSeparator = "!/"
+
+// maxArchiveMemberSize is the maximum size of archive members whose content is compared.
+const maxArchiveMemberSize = 1 << 20
+
+// maxArchiveSize is the maximum size of a gzipped tar archive once gunzipped.
+const maxArchiveSize = 64 << 20
+
+// archiveMember is a file, directory or link of an archive.
+type archiveMember struct {
+	name string
+	mode fs.FileMode
+	size int64
+	link string
+	// content is empty for members over maxArchiveMemberSize, compared by
+	// their digest instead, the hex SHA-256 of their content.
+	content []byte
+	digest  string
+}
+
+// attrs returns the attributes of m compared as the keys of a write_files entry.
+func (m archiveMember) attrs() map[string]interface{} {
+	attrs := map[string]interface{}{"mode": fmt.Sprintf("%04o", m.mode.Perm())}
+	switch {
+	case m.mode.IsDir():
+		attrs["type"] = "directory"
+	case m.mode&fs.ModeSymlink != 0:
+		attrs["type"] = "symlink"
+		attrs["link"] = m.link
+	default:
+		attrs["size"] = fmt.Sprint(m.size)
+		attrs["content"] = string(m.content)
+		if m.digest != "" {
+			attrs["content"] = fmt.Sprintf("(over %s) sha256 %s", formatBytes(maxArchiveMemberSize), m.digest)
+		}
+	}
+	return attrs
+}
+
+// readArchive returns the kind and members of data if it is a tar, tar.gz or
+// zip archive. Content declared as gz+b64 is gunzipped by decode already, a
+// tar.gz declared as b64 only is gunzipped here, up to maxArchiveSize.
+func readArchive(data []byte) (string, []archiveMember, bool) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		tarData, err := gunzipArchive(data)
+		if err != nil || !isTar(tarData) {
+			return "", nil, false
+		}
+		members, err := readTar(tarData)
+		return "tar.gz", members, err == nil
+	case isTar(data):
+		members, err := readTar(data)
+		return "tar", members, err == nil
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		members, err := readZip(data)
+		return "zip", members, err == nil
+	}
+	return "", nil, false
+}
+func isTar(data []byte) bool {
+	return len(data) > 262 && string(data[257:262]) == "ustar"
+}
+
+// gunzipArchive gunzips data, and fails if the result is over maxArchiveSize.
+func gunzipArchive(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gunzipped, err := io.ReadAll(io.LimitReader(r, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(gunzipped) > maxArchiveSize {
+		return nil, fmt.Errorf("archive over %s", formatBytes(maxArchiveSize))
+	}
+	return gunzipped, nil
+}
+func readTar(data []byte) ([]archiveMember, error) {
+	members := make([]archiveMember, 0)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		m := archiveMember{name: strings.TrimPrefix(hdr.Name, "./"), mode: hdr.FileInfo().Mode(), size: hdr.Size, link: hdr.Linkname}
+		if m.name == "" || m.name == "." {
+			// the root directory of archives made with "tar -C dir ."
+			continue
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if m.content, m.digest, err = readMember(tr); err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, m)
+	}
+}
+func readZip(data []byte) ([]archiveMember, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	members := make([]archiveMember, 0, len(zr.File))
+	for _, f := range zr.File {
+		m := archiveMember{name: f.Name, mode: f.Mode(), size: int64(f.UncompressedSize64)}
+		if m.mode.IsRegular() || m.mode&fs.ModeSymlink != 0 {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			m.content, m.digest, err = readMember(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if m.mode&fs.ModeSymlink != 0 {
+			// zip stores the target of a link as its content
+			m.link, m.content = string(m.content), nil
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// readMember reads the content of a member, up to maxArchiveMemberSize. The
+// content of a larger member is streamed through SHA-256 instead, and its hex
+// digest returned.
+func readMember(r io.Reader) ([]byte, string, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxArchiveMemberSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) <= maxArchiveMemberSize {
+		return content, "", nil
+	}
+	h := sha256.New()
+	h.Write(content)
+	if _, err = io.Copy(h, r); err != nil {
+		return nil, "", err
+	}
+	return nil, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// expandArchives returns files with the content of tar and zip archives
+// replaced by a summary, each followed by an entry per archive member, so
+// archives are compared as a directory.
+func expandArchives(files []writeFile) []writeFile {
+	expanded := make([]writeFile, 0, len(files))
+	for _, f := range files {
+		expanded = append(expanded, f)
+		kind, members, ok := readArchive([]byte(toString(f.attrs["content"])))
+		if _, hasContent := f.attrs["content"]; !hasContent || !ok {
+			continue
+		}
+		attrs := make(map[string]interface{}, len(f.attrs))
+		for k, v := range f.attrs {
+			attrs[k] = v
+		}
+		attrs["content"] = fmt.Sprintf("(archive) %s, %s", kind, plural(len(members), "member"))
+		expanded[len(expanded)-1].attrs = attrs
+		for _, m := range members {
+			key := fileKey{f.key.path + archiveSeparator + strings.TrimSuffix(m.name, "/"), f.key.occurrence}
+			expanded = append(expanded, writeFile{key: key, attrs: m.attrs()})
+		}
+	}
+	return expanded
+}
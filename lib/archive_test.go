@@ -0,0 +1,141 @@
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMember struct {
+	name, content string
+	mode          int64
+}
+
+func buildTar(members []testMember) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		tw.WriteHeader(&tar.Header{Name: m.name, Mode: m.mode, Size: int64(len(m.content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(m.content))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+func buildZip(members []testMember) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		fh := &zip.FileHeader{Name: m.name, Method: zip.Deflate}
+		fh.SetMode(fs.FileMode(m.mode))
+		w, _ := zw.CreateHeader(fh)
+		w.Write([]byte(m.content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDiffYAML_Archive(t *testing.T) {
+	before := []testMember{{"bin/start.sh", "echo one\necho two\n", 0644}, {"old.conf", "x=1\n", 0644}}
+	after := []testMember{{"bin/start.sh", "echo one\necho 2\n", 0755}, {"app.conf", "y=2\n", 0644}}
+	tarGz := func(members []testMember) string {
+		b, _ := gzipData(buildTar(members))
+		return "content: " + base64Encode(b) + "\n  encoding: gz+b64"
+	}
+	tarGzB64 := func(members []testMember) string {
+		b, _ := gzipData(buildTar(members))
+		return "content: " + base64Encode(b) + "\n  encoding: b64"
+	}
+	zipB64 := func(members []testMember) string {
+		return "content: " + base64Encode(buildZip(members)) + "\n  encoding: b64"
+	}
+	tests := []struct {
+		name   string
+		m1, m2 string
+		expect string
+	}{
+		{"tar.gz", tarGz(before), tarGz(after), `+- path: /etc/sysconfig/selinux!/app.conf
++  content: y=2
++  mode: 0644
++  size: 4
+ - path: /etc/sysconfig/selinux!/bin/start.sh
+   content:
+     ...
+    2|      -    echo two
+     |2     +    echo 2
+-  mode: 0644
++  mode: 0755
+-  size: 18
++  size: 16
+-- path: /etc/sysconfig/selinux!/old.conf
+-  content: x=1
+-  mode: 0644
+-  size: 4
+`},
+		{"tar.gz b64", tarGzB64(before), tarGzB64(after[:1]), ` - path: /etc/sysconfig/selinux  # encoding: base64
+-  content: (archive) tar.gz, 2 members
++  content: (archive) tar.gz, 1 member
+ - path: /etc/sysconfig/selinux!/bin/start.sh
+   content:
+     ...
+    2|      -    echo two
+     |2     +    echo 2
+-  mode: 0644
++  mode: 0755
+-  size: 18
++  size: 16
+-- path: /etc/sysconfig/selinux!/old.conf
+-  content: x=1
+-  mode: 0644
+-  size: 4
+`},
+		{"zip", zipB64(before), zipB64(after[:1]), ` - path: /etc/sysconfig/selinux  # encoding: base64
+-  content: (archive) zip, 2 members
++  content: (archive) zip, 1 member
+ - path: /etc/sysconfig/selinux!/bin/start.sh
+   content:
+     ...
+    2|      -    echo two
+     |2     +    echo 2
+-  mode: 0644
++  mode: 0755
+-  size: 18
++  size: 16
+-- path: /etc/sysconfig/selinux!/old.conf
+-  content: x=1
+-  mode: 0644
+-  size: 4
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewWithOptions(Options{NoColor: true})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, d.diffYAML(buildYAML(tt.m1), buildYAML(tt.m2)))
+		})
+	}
+}
+
+func TestReadArchive_LargeMember(t *testing.T) {
+	large := strings.Repeat("a", maxArchiveMemberSize+10)
+	digest := func(members []archiveMember) string {
+		return toString(members[0].attrs()["content"])
+	}
+	_, before, ok := readArchive(buildTar([]testMember{{"big.bin", large, 0644}}))
+	assert.True(t, ok)
+	_, after, ok := readArchive(buildTar([]testMember{{"big.bin", large[:len(large)-1] + "b", 0644}}))
+	assert.True(t, ok)
+	sum := sha256.Sum256([]byte(large))
+	assert.Equal(t, "(over 1024.0 KiB) sha256 "+hex.EncodeToString(sum[:]), digest(before))
+	assert.NotEqual(t, digest(before), digest(after))
+
+	_, zipped, ok := readArchive(buildZip([]testMember{{"big.bin", large, 0644}}))
+	assert.True(t, ok)
+	assert.Equal(t, digest(before), digest(zipped))
+}
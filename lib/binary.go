@@ -0,0 +1,46 @@
+package diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Modes of Options.Binary
+const (
+	// BinarySummary compares the MIME type, size and SHA-256 of binary content.
+	BinarySummary = "summary"
+	// BinaryHex compares a hexdump of binary content, like "hexdump -C".
+	BinaryHex = "hex"
+)
+
+// isBinary reports whether data is binary content: not UTF-8, or holding NUL bytes.
+func isBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0
+}
+
+// binaryLines returns binary content s as lines compared in place of its
+// bytes, by the mode of Options.Binary; text content is returned as is.
+func (d *Diff) binaryLines(s string) string {
+	if !isBinary([]byte(s)) {
+		return s
+	}
+	if d.opts.Binary == BinaryHex {
+		return strings.TrimSuffix(hex.Dump([]byte(s)), "\n")
+	}
+	sum := sha256.Sum256([]byte(s))
+	// a single line, so the whole summary is shown before and after
+	return fmt.Sprintf("(binary) %s, %d bytes, sha256 %s", http.DetectContentType([]byte(s)), len(s), hex.EncodeToString(sum[:]))
+}
+
+func validateBinaryMode(mode string) error {
+	switch mode {
+	case "", BinarySummary, BinaryHex:
+		return nil
+	}
+	return fmt.Errorf("unknown binary mode %q, must be one of [%s %s]", mode, BinarySummary, BinaryHex)
+}
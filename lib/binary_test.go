@@ -0,0 +1,42 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffYAML_Binary(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + string(make([]byte, 24))
+	changed := png[:20] + "\xff" + png[21:]
+	content := func(s string) string {
+		return "content: " + base64Encode([]byte(s)) + "\n  encoding: b64"
+	}
+	tests := []struct {
+		name   string
+		mode   string
+		m1, m2 string
+		expect string
+	}{
+		{"summary", BinarySummary, content(png), content(changed), " - path: /etc/sysconfig/selinux  # encoding: base64\n" +
+			"-  content: (binary) image/png, 32 bytes, sha256 9656be35bd353ebedd79d7d24a14df408ef96b99fb4e4b4542e3bdd56de73134\n" +
+			"+  content: (binary) image/png, 32 bytes, sha256 614e25cee5327564fc3e1113d5cf07c77f39884ffec6502d683c8bed18390a2d\n"},
+		{"hex", BinaryHex, content(png), content(changed), " - path: /etc/sysconfig/selinux  # encoding: base64\n   content:\n" +
+			"     ...\n" +
+			"    2|      -    00000010  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|\n" +
+			"     |2     +    00000010  00 00 00 00 ff 00 00 00  00 00 00 00 00 00 00 00  |................|\n"},
+		{"text", BinaryHex, "content: hello", "content: world", " - path: /etc/sysconfig/selinux\n-  content: hello\n+  content: world\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewWithOptions(Options{NoColor: true, Binary: tt.mode})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, d.diffYAML(buildYAML(tt.m1), buildYAML(tt.m2)))
+		})
+	}
+}
+
+func TestNewWithOptions_BinaryMode(t *testing.T) {
+	_, err := NewWithOptions(Options{Binary: "octal"})
+	assert.EqualError(t, err, `unknown binary mode "octal", must be one of [summary hex]`)
+}
@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commandKeys are the cloud-config keys holding ordered lists of commands.
+var commandKeys = []string{"bootcmd", "runcmd"}
+
+// commandLists returns the commands of the keys of commandKeys set in
+// cloud-config s, see normalizeCommand.
+func commandLists(s string) map[string][]string {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(s), &document); err != nil {
+		return nil
+	}
+	lists := make(map[string][]string)
+	for _, node := range document.Content {
+		for _, key := range commandKeys {
+			value := getNodeByKey(node, key)
+			if value == nil || value.Kind != yaml.SequenceNode {
+				continue
+			}
+			commands := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				commands = append(commands, normalizeCommand(item))
+			}
+			lists[key] = commands
+		}
+	}
+	return lists
+}
+
+// normalizeCommand returns a command of runcmd or bootcmd as the shell runs
+// it: a string as is, or an argv list joined with its arguments quoted as
+// needed, so both forms of a command compare equal. Whitespace within a string
+// is kept, it may be quoted.
+func normalizeCommand(node *yaml.Node) string {
+	if node.Kind != yaml.SequenceNode {
+		return strings.TrimRight(node.Value, "\n")
+	}
+	args := make([]string, 0, len(node.Content))
+	for _, arg := range node.Content {
+		args = append(args, shellQuote(arg.Value))
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote returns s single-quoted if it holds whitespace or characters
+// special to the shell.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`;&|<>()*?[]#~!{}") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandList is a list of commands as compared, see Diff.prepareCommands.
+type commandList struct {
+	commands []string
+	// index holds the index of each command in the cloud-config list, which
+	// differs once ignored commands are dropped.
+	index []int
+}
+
+// newCommandList returns a list of commands, at their own index.
+func newCommandList(commands ...string) commandList {
+	index := make([]int, len(commands))
+	for i := range index {
+		index[i] = i
+	}
+	return commandList{commands, index}
+}
+
+// listKey returns the cloud-config key of the field of a command, e.g. runcmd
+// for "runcmd[3]" or "runcmd[1] -> runcmd[4]", see diffCommands.
+func listKey(key string) string {
+	return strings.SplitN(key, "[", 2)[0]
+}
+
+// diffCommands returns the changes between two ordered lists of commands of
+// key, one field per command: "runcmd[3]" added or removed at its index after
+// or before, or "runcmd[1] -> runcmd[4]" for a command that only moved.
+// Commands are matched by their longest common subsequence.
+func diffCommands(key string, listA, listB commandList) []*Field {
+	a, b := listA.commands, listB.commands
+	// walk both lists along the common subsequence, in order
+	type change struct {
+		action Action
+		index  int
+	}
+	changes := make([]change, 0)
+	common := lcs(a, b)
+	for i, j, k := 0, 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case k < len(common) && i == common[k][0] && j == common[k][1]:
+			i, j, k = i+1, j+1, k+1
+		case i < len(a) && (k == len(common) || i < common[k][0]):
+			changes = append(changes, change{Delete, i})
+			i++
+		default:
+			changes = append(changes, change{Create, j})
+			j++
+		}
+	}
+	// a command deleted and added elsewhere moved
+	movedFrom := make(map[int]int)
+	moved := make(map[int]bool)
+	for _, added := range changes {
+		if added.action != Create {
+			continue
+		}
+		for _, deleted := range changes {
+			if deleted.action == Delete && !moved[deleted.index] && a[deleted.index] == b[added.index] {
+				movedFrom[added.index], moved[deleted.index] = deleted.index, true
+				break
+			}
+		}
+	}
+	fields := make([]*Field, 0, len(changes))
+	for _, c := range changes {
+		switch {
+		case c.action == Delete && !moved[c.index]:
+			fields = append(fields, &Field{Key: fmt.Sprintf("%s[%d]", key, listA.index[c.index]), Action: Delete,
+				Chunks: []Chunk{{Deleted: strings.Split(a[c.index], "\n")}}})
+		case c.action == Create:
+			if i, ok := movedFrom[c.index]; ok {
+				fields = append(fields, &Field{Key: fmt.Sprintf("%s[%d] -> %s[%d]", key, listA.index[i], key, listB.index[c.index]), Action: Update,
+					Chunks: []Chunk{{Equal: strings.Split(b[c.index], "\n")}}})
+				continue
+			}
+			fields = append(fields, &Field{Key: fmt.Sprintf("%s[%d]", key, listB.index[c.index]), Action: Create,
+				Chunks: []Chunk{{Added: strings.Split(b[c.index], "\n")}}})
+		}
+	}
+	return fields
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+func lcs(a, b []string) [][2]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	pairs := make([][2]int, 0, lengths[0][0])
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
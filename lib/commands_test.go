@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		expect string
+	}{
+		{"string", "systemctl enable foo", "systemctl enable foo"},
+		{"string quoted", "echo 'a  b'", "echo 'a  b'"},
+		{"argv", "[systemctl, enable, foo]", "systemctl enable foo"},
+		{"argv quoted", `[sh, -c, "echo 'a b' > /tmp/x"]`, `sh -c 'echo '\''a b'\'' > /tmp/x'`},
+		{"argv empty", `[touch, ""]`, "touch ''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.in), &node))
+			assert.Equal(t, tt.expect, normalizeCommand(node.Content[0]))
+		})
+	}
+}
+
+func TestDiffCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []string
+		expect []string
+	}{
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, []string{}},
+		{"added", []string{"a", "b"}, []string{"a", "x", "b"}, []string{"+runcmd[1]: x"}},
+		{"removed", []string{"a", "b", "c"}, []string{"a", "c"}, []string{"-runcmd[1]: b"}},
+		{"changed", []string{"a", "b"}, []string{"a", "c"}, []string{"-runcmd[1]: b", "+runcmd[1]: c"}},
+		{"moved", []string{"a", "b", "c", "d"}, []string{"b", "c", "d", "a"}, []string{" runcmd[0] -> runcmd[3]: a"}},
+		{"moved and added", []string{"a", "b", "c"}, []string{"c", "x", "a", "b"}, []string{" runcmd[2] -> runcmd[0]: c", "+runcmd[1]: x"}},
+		{"from nothing", nil, []string{"a"}, []string{"+runcmd[0]: a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([]string, 0)
+			for _, field := range diffCommands("runcmd", newCommandList(tt.a...), newCommandList(tt.b...)) {
+				for _, c := range field.Chunks {
+					for _, line := range c.Deleted {
+						lines = append(lines, "-"+field.Key+": "+line)
+					}
+					for _, line := range c.Added {
+						lines = append(lines, "+"+field.Key+": "+line)
+					}
+					for _, line := range c.Equal {
+						lines = append(lines, " "+field.Key+": "+line)
+					}
+				}
+			}
+			assert.Equal(t, tt.expect, lines)
+		})
+	}
+}
+
+func TestCompareYAML_Commands(t *testing.T) {
+	before := `#cloud-config
+bootcmd:
+- echo boot
+runcmd:
+- [systemctl, daemon-reload]
+- systemctl start app
+- echo done
+`
+	after := `#cloud-config
+bootcmd:
+- echo boot
+runcmd:
+- systemctl daemon-reload
+- echo done
+- systemctl enable app
+- systemctl start app
+`
+	d, err := NewWithOptions(Options{NoColor: true})
+	assert.NoError(t, err)
+	expect := `+runcmd[2]: systemctl enable app
+ runcmd[1] -> runcmd[3]: systemctl start app
+`
+	assert.Equal(t, expect, d.diffYAML(before, after))
+}
+
+func TestCompareYAML_CommandsIgnored(t *testing.T) {
+	ignore, err := LoadIgnore(strings.NewReader("^echo \\d+$\n"))
+	assert.NoError(t, err)
+	d, err := NewWithOptions(Options{NoColor: true, Ignore: ignore})
+	assert.NoError(t, err)
+	before := "#cloud-config\nruncmd:\n- echo 1\n- echo 2\n- systemctl start app\n"
+	after := "#cloud-config\nruncmd:\n- echo 3\n- systemctl start app\n- systemctl enable app\n"
+	// indices are those of the cloud-config lists, ignored commands included
+	assert.Equal(t, "+runcmd[2]: systemctl enable app\n", d.diffYAML(before, after))
+}
@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyDescribers holds the cloud-config keys compared besides write_files, and
+// returns the lines the value of each is compared by.
+var keyDescribers = map[string]func(value *yaml.Node) []string{
+	"ssh_authorized_keys": authorizedKeyNodeLines,
+}
+
+// configKeys returns the keys of keyDescribers set in cloud-config s, with
+// their value as lines.
+func configKeys(s string) map[string]interface{} {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(s), &document); err != nil {
+		return nil
+	}
+	keys := make(map[string]interface{})
+	for _, node := range document.Content {
+		for key, describe := range keyDescribers {
+			if value := getNodeByKey(node, key); value != nil {
+				keys[key] = strings.Join(describe(value), "\n")
+			}
+		}
+	}
+	return keys
+}
+
+// compareKeys returns the changes of the keys of keyDescribers and
+// commandKeys, as the fields of an Object with an empty path, nil if none changed.
+func (d *Diff) compareKeys(sc scope, s1, s2 string) *Object {
+	m1, m2 := configKeys(s1), configKeys(s2)
+	for _, m := range []map[string]interface{}{m1, m2} {
+		for k, v := range m {
+			m[k] = d.prepare(sc, toString(v))
+		}
+	}
+	fields := diffMapToChunks(m1, m2)
+	for _, field := range fields {
+		// lists, even of a single item
+		field.Block = true
+	}
+	lists1, lists2 := commandLists(s1), commandLists(s2)
+	for _, key := range commandKeys {
+		fields = append(fields, diffCommands(key, d.prepareCommands(sc, lists1[key]), d.prepareCommands(sc, lists2[key]))...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	// command fields are named after their index, e.g. runcmd[3]
+	sort.SliceStable(fields, func(i, j int) bool {
+		return listKey(fields[i].Key) < listKey(fields[j].Key)
+	})
+	return &Object{Action: Update, Fields: fields}
+}
+
+// prepareCommands returns commands as they are compared, see prepare; ignored
+// commands are dropped, the others keep their index.
+func (d *Diff) prepareCommands(sc scope, commands []string) commandList {
+	prepared := commandList{commands: make([]string, 0, len(commands)), index: make([]int, 0, len(commands))}
+	for i, command := range commands {
+		if command = d.prepare(sc, command); command != "" {
+			prepared.commands = append(prepared.commands, command)
+			prepared.index = append(prepared.index, i)
+		}
+	}
+	return prepared
+}
+
+// authorizedKeyNodeLines returns a list of OpenSSH public keys, one line per
+// key, see describeAuthorizedKey.
+func authorizedKeyNodeLines(value *yaml.Node) []string {
+	nodes := value.Content
+	if value.Kind == yaml.ScalarNode {
+		nodes = []*yaml.Node{value}
+	}
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		line := node.Value
+		if desc, ok := describeAuthorizedKey(line); ok {
+			line = desc
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DecodeDiagnostic is a write_files entry whose content doesn't decode as
+// declared by its encoding. Its severity is error when cloud-init fails to
+// write the file at boot, warning when it writes the content as is, e.g. for
+// an encoding it doesn't know. User data of a plan that can't be read as MIME
+// parts is reported with Part set to the user data argument and no Path.
+type DecodeDiagnostic struct {
+	// Address of the resource, empty when comparing blobs.
+	Address string
+	// Side is "before" or "after".
+	Side string
+	// Part is the file name of the MIME part, or its Content-Type.
+	Part string
+	// Path of the write_files entry.
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+func (d DecodeDiagnostic) String() string {
+	if d.Path == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// decodeDiagnostics returns the diagnostics of the write_files entries of the
+// cloud-config parts in parts, side is "before" or "after". Filters are not
+// applied, as the diagnostics are checked by Strict.
+func (d *Diff) decodeDiagnostics(address, side string, parts []*part) []DecodeDiagnostic {
+	diagnostics := make([]DecodeDiagnostic, 0)
+	for _, p := range parts {
+		if !p.isYAML() {
+			continue
+		}
+		for _, f := range toWriteFiles(string(p.body)) {
+			if f.decodeErr == nil {
+				continue
+			}
+			severity := SeverityError
+			if errors.Is(f.decodeErr, errUnknownEncoding) {
+				severity = SeverityWarning
+			}
+			diagnostics = append(diagnostics, DecodeDiagnostic{address, side, partName(p.header), f.key.path, f.decodeErr.Error(), severity})
+		}
+	}
+	return diagnostics
+}
+
+// checkDecoding returns the diagnostics of parts before and after.
+func (d *Diff) checkDecoding(address string, partsA, partsB []*part) []DecodeDiagnostic {
+	return append(d.decodeDiagnostics(address, "before", partsA), d.decodeDiagnostics(address, "after", partsB)...)
+}
+
+// DecodeError is returned when Options.Strict is set and content doesn't decode as declared.
+// It holds the diagnostics of severity error.
+type DecodeError struct {
+	Diagnostics []DecodeDiagnostic
+}
+
+func (e *DecodeError) Error() string {
+	files := make([]string, 0, len(e.Diagnostics))
+	for _, diag := range e.Diagnostics {
+		file := strings.TrimSpace(diag.Address + " " + diag.Path)
+		files = append(files, fmt.Sprintf("%s (%s)", file, diag.Side))
+	}
+	return fmt.Sprintf("content doesn't decode as declared: %s", strings.Join(files, ", "))
+}
+
+// decodeError returns a DecodeError holding the diagnostics of severity error
+// of the after side if Options.Strict is set and there are any. Content already
+// broken before is reported but doesn't fail the run, as the change doesn't
+// introduce it, and neither do warnings, as cloud-init writes that content.
+func (d *Diff) decodeError(diagnostics []DecodeDiagnostic) error {
+	if !d.opts.Strict {
+		return nil
+	}
+	after := make([]DecodeDiagnostic, 0)
+	for _, diag := range diagnostics {
+		if diag.Side == "after" && diag.Severity == SeverityError {
+			after = append(after, diag)
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+	return &DecodeError{after}
+}
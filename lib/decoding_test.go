@@ -0,0 +1,89 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeDiagnostics(t *testing.T) {
+	truncated, _ := gzipData([]byte("line1\n"))
+	truncated = truncated[:len(truncated)-4]
+	tests := []struct {
+		name     string
+		encoding string
+		content  string
+		expect   string
+	}{
+		{"valid", "b64", base64Encode([]byte("line1\n")), ""},
+		{"plain text", "b64", "hello world", "encoding b64 declared but content is not valid base64 at offset 5"},
+		{"not gzip", "gz+b64", base64Encode([]byte("#!/bin/bash\necho hello\n")), "encoding gz+b64 declared but content is not valid gzip: gzip: invalid header"},
+		{"truncated gzip", "gzip+base64", base64Encode(truncated), "encoding gzip+base64 declared but content is not valid gzip: unexpected EOF"},
+		{"quoted", `"base64"`, "hello world", "encoding base64 declared but content is not valid base64 at offset 5"},
+		{"unknown", "base65", "hello", "unknown encoding base65, cloud-init writes it as text/plain"},
+		{"none", "", "hello", ""},
+		{"none encoded", "", base64Encode([]byte("line1\n")), "no encoding declared but content looks like base64, cloud-init writes it as text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := "content: " + tt.content
+			if tt.encoding != "" {
+				file += "\n  encoding: " + tt.encoding
+			}
+			d := New()
+			parts := []*part{{header: yamlHeader(), body: []byte(buildYAML(file))}}
+			diagnostics := d.decodeDiagnostics("aws_instance.this", "after", parts)
+			if tt.expect == "" {
+				assert.Empty(t, diagnostics)
+				return
+			}
+			severity := SeverityError
+			if tt.encoding == "base65" || tt.encoding == "" {
+				severity = SeverityWarning
+			}
+			assert.Equal(t, []DecodeDiagnostic{{"aws_instance.this", "after", "text/cloud-config", "/etc/sysconfig/selinux", tt.expect, severity}}, diagnostics)
+		})
+	}
+}
+
+func TestDiffBlobs_Strict(t *testing.T) {
+	userDataEncoding := func(encoding, content string) string {
+		doc := "Content-Type: multipart/mixed; boundary=\"B\"\r\n\r\n--B\r\nContent-Type: text/cloud-config\r\n\r\n" +
+			"#cloud-config\nwrite_files:\n- path: /etc/motd\n  encoding: " + encoding + "\n  content: " + content + "\n\r\n--B--\r\n"
+		b, _ := gzipData([]byte(doc))
+		return base64Encode(b)
+	}
+	userData := func(content string) string {
+		return userDataEncoding("b64", content)
+	}
+	before, after := userData(base64Encode([]byte("hello\n"))), userData("hello world")
+	for _, strict := range []bool{false, true} {
+		d, err := NewWithOptions(Options{NoColor: true, Strict: strict})
+		assert.NoError(t, err)
+		res, err := d.DiffBlobs(before, after)
+		assert.NoError(t, err)
+		assert.Len(t, res.Diagnostics, 1)
+		var buf bytes.Buffer
+		assert.NoError(t, d.RenderResult(&buf, res))
+		assert.True(t, strings.HasSuffix(buf.String(), "! decode (after) text/cloud-config /etc/motd: encoding b64 declared but content is not valid base64 at offset 5"), buf.String())
+
+		err = d.CheckResult(res)
+		var decodeErr *DecodeError
+		assert.Equal(t, strict, errors.As(err, &decodeErr))
+	}
+	// content broken before only is reported, but doesn't fail
+	d, err := NewWithOptions(Options{NoColor: true, Strict: true})
+	assert.NoError(t, err)
+	res, err := d.DiffBlobs(after, before)
+	assert.NoError(t, err)
+	assert.Equal(t, "before", res.Diagnostics[0].Side)
+	assert.NoError(t, d.CheckResult(res))
+	// an unknown encoding is written as text/plain, reported as a warning only
+	res, err = d.DiffBlobs(before, userDataEncoding("base65", "hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, SeverityWarning, res.Diagnostics[0].Severity)
+	assert.NoError(t, d.CheckResult(res))
+}
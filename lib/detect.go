@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/base64"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDecodeDepth is the maximum number of encodings detected on top of each other.
+const maxDecodeDepth = 8
+
+// EncodingChain is the sequence of encodings detected in content, outermost
+// first, e.g. ["base64", "gzip"] for gzipped content encoded in base64.
+type EncodingChain []string
+
+// String returns the encodings joined by "+", e.g. "base64+gzip".
+func (c EncodingChain) String() string {
+	return strings.Join(c, "+")
+}
+
+// formatEncodings returns chains before and after for display: the chain if
+// both are equal or one side has no content (a nil chain), "before -> after"
+// otherwise, "" if nothing is encoded.
+func formatEncodings(before, after EncodingChain) string {
+	b, a := before.String(), after.String()
+	switch {
+	case before == nil || b == a:
+		return a
+	case after == nil:
+		return b
+	case b == "":
+		return "(none) -> " + a
+	case a == "":
+		return b + " -> (none)"
+	}
+	return b + " -> " + a
+}
+
+// detectEncoding decodes data until it is neither compressed nor base64
+// encoded, up to maxDecodeDepth times, and returns the decoded data and the
+// encodings detected.
+func detectEncoding(data []byte) ([]byte, EncodingChain) {
+	chain := make(EncodingChain, 0)
+	for len(chain) < maxDecodeDepth {
+		decoded, encoding, ok := decodeOnce(data)
+		if !ok {
+			break
+		}
+		data = decoded
+		chain = append(chain, encoding)
+	}
+	return data, chain
+}
+
+// decodeOnce detects the outermost encoding of data by its magic bytes, or by
+// the base64 alphabet, and decodes it.
+func decodeOnce(data []byte) ([]byte, string, bool) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		if decoded, err := gunzipData(data); err == nil {
+			return decoded, "gzip", true
+		}
+	case isZlib(data):
+		if decoded, err := zlibDecompress(data); err == nil {
+			return decoded, "zlib", true
+		}
+	case isBzip2(data):
+		if decoded, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(data))); err == nil {
+			return decoded, "bzip2", true
+		}
+	}
+	return decodeBase64(data)
+}
+
+// decodeBase64 decodes data in the standard or URL base64 alphabet, possibly
+// wrapped on several lines. As any short word is valid base64, data is only
+// decoded if the result is compressed or text.
+func decodeBase64(data []byte) ([]byte, string, bool) {
+	s := string(removeSpaces(bytes.TrimSpace(data)))
+	if len(s) < 4 {
+		return nil, "", false
+	}
+	// whitespace only separates lines of wrapped base64
+	if strings.ContainsAny(string(bytes.TrimSpace(data)), " \t") {
+		return nil, "", false
+	}
+	encodings := []struct {
+		name string
+		enc  *base64.Encoding
+	}{
+		{"base64", base64.StdEncoding},
+		{"base64url", base64.URLEncoding},
+		{"base64", base64.RawStdEncoding},
+		{"base64url", base64.RawURLEncoding},
+	}
+	for _, e := range encodings {
+		decoded, err := e.enc.DecodeString(s)
+		if err != nil || len(decoded) == 0 {
+			continue
+		}
+		if isCompressed(decoded) || isText(decoded) {
+			return decoded, e.name, true
+		}
+		return nil, "", false
+	}
+	return nil, "", false
+}
+
+// gzipMagic are the first bytes of gzip compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func isZlib(data []byte) bool {
+	// CMF is deflate with a window up to 32K, and CMF*256+FLG is a multiple of 31
+	return len(data) > 2 && data[0]&0x0f == 8 && data[0]>>4 <= 7 && (int(data[0])<<8|int(data[1]))%31 == 0
+}
+func isBzip2(data []byte) bool {
+	return len(data) > 4 && bytes.HasPrefix(data, []byte("BZh")) && data[3] >= '1' && data[3] <= '9'
+}
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic) || isZlib(data) || isBzip2(data)
+}
+
+// isText reports whether data is UTF-8 without control characters other than whitespace.
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func zlibDecompress(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+func removeSpaces(b []byte) []byte {
+	return bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, b)
+}
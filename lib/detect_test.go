@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	text := "#!/bin/bash\necho hello\n"
+	gzipped, _ := gzipData([]byte(text))
+	var zlibbed bytes.Buffer
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write([]byte(text))
+	zw.Close()
+	// bzip2 of "hello\n", the standard library has no bzip2 writer
+	bzipped, _ := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWcHAgOIAAAFBAAAQAkSgADDNAMNGKZcXckU4UJDBwIDi")
+	nested, _ := gzipData([]byte(base64Encode([]byte(text))))
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+		chain  EncodingChain
+	}{
+		{"text", text, text, EncodingChain{}},
+		{"short word", "true", "true", EncodingChain{}},
+		{"base64", base64Encode([]byte(text)), text, EncodingChain{"base64"}},
+		{"base64 without padding", base64.RawStdEncoding.EncodeToString([]byte(text)), text, EncodingChain{"base64"}},
+		{"base64url", base64.URLEncoding.EncodeToString([]byte("<<???>>\n")), "<<???>>\n", EncodingChain{"base64url"}},
+		{"wrapped base64", wrap(base64Encode([]byte(text)), 16) + "\n", text, EncodingChain{"base64"}},
+		{"gzip", string(gzipped), text, EncodingChain{"gzip"}},
+		{"zlib", zlibbed.String(), text, EncodingChain{"zlib"}},
+		{"bzip2", string(bzipped), "hello\n", EncodingChain{"bzip2"}},
+		{"base64 gzip", base64Encode(gzipped), text, EncodingChain{"base64", "gzip"}},
+		{"base64 gzip base64", base64Encode(nested), text, EncodingChain{"base64", "gzip", "base64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, chain := detectEncoding([]byte(tt.input))
+			assert.Equal(t, tt.expect, string(decoded))
+			assert.Equal(t, tt.chain, chain)
+		})
+	}
+}
+
+func TestDetectEncoding_DepthLimit(t *testing.T) {
+	s := "echo hello"
+	for i := 0; i < maxDecodeDepth+2; i++ {
+		s = base64Encode([]byte(s))
+	}
+	decoded, chain := detectEncoding([]byte(s))
+	assert.Len(t, chain, maxDecodeDepth)
+	assert.Equal(t, base64Encode([]byte(base64Encode([]byte("echo hello")))), string(decoded))
+}
+
+func TestDecode(t *testing.T) {
+	gzipped, _ := gzipData([]byte(base64Encode([]byte("line1\n"))))
+	tests := []struct {
+		name     string
+		content  string
+		encoding string
+		expect   string
+		chain    EncodingChain
+		err      string
+	}{
+		{"declared", base64Encode([]byte("line1\n")), "b64", "line1\n", EncodingChain{"base64"}, ""},
+		{"declared upper case", base64Encode([]byte("line1\n")), " B64 ", "line1\n", EncodingChain{"base64"}, ""},
+		{"declared only", base64Encode(gzipped), "gz+b64", base64Encode([]byte("line1\n")), EncodingChain{"base64", "gzip"}, ""},
+		{"undeclared", base64Encode(gzipped), "", base64Encode(gzipped), EncodingChain{},
+			"no encoding declared but content looks like base64+gzip+base64, cloud-init writes it as text/plain"},
+		{"undeclared text", "line1\n", "", "line1\n", EncodingChain{}, ""},
+		{"text/plain", "line1\n", "text/plain", "line1\n", EncodingChain{}, ""},
+		{"text/plain literal", "c2VjcmV0", "Text/Plain", "c2VjcmV0", EncodingChain{}, ""},
+		{"unknown", base64Encode(gzipped), "b32", base64Encode(gzipped), EncodingChain{},
+			"unknown encoding b32, cloud-init writes it as text/plain, content looks like base64+gzip+base64"},
+		{"unknown text", "line1\n", "b32", "line1\n", EncodingChain{}, "unknown encoding b32, cloud-init writes it as text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, chain, err := decode(tt.content, tt.encoding)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.ErrorIs(t, err, errUnknownEncoding)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expect, decoded)
+			assert.Equal(t, tt.chain, chain)
+		})
+	}
+}
+
+func TestFormatEncodings(t *testing.T) {
+	tests := []struct {
+		before, after EncodingChain
+		expect        string
+	}{
+		{EncodingChain{}, EncodingChain{}, ""},
+		{nil, EncodingChain{"base64"}, "base64"},
+		{EncodingChain{"base64", "gzip"}, nil, "base64+gzip"},
+		{EncodingChain{"base64"}, EncodingChain{"base64"}, "base64"},
+		{EncodingChain{}, EncodingChain{"base64"}, "(none) -> base64"},
+		{EncodingChain{"base64"}, EncodingChain{"base64", "gzip"}, "base64 -> base64+gzip"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expect, formatEncodings(tt.before, tt.after))
+	}
+}
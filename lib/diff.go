@@ -9,41 +9,172 @@ import (
 	"strings"
 
 	"github.com/kylelemons/godebug/diff"
-	"github.com/mitchellh/colorstring"
 	"gopkg.in/yaml.v3"
 )
 
+// Options configures a Diff. The zero value renders colored text, redacts
+// secrets and validates cloud-config parts.
+type Options struct {
+	// NoColor disables colors in the text format.
+	NoColor bool
+	// Context is the number of unchanged lines shown around changed lines in
+	// the text format, 0 shows "..." in place of unchanged lines.
+	Context int
+	// Format is the name of the output format of Render and RenderResult:
+	// "text" (the default), "no-color", "markdown", "html", "github-annotations",
+	// "gitlab-codequality", "stat", "summary", or one added by RegisterFormat.
+	Format string
+	// CommentSizeLimit is the maximum size in bytes of the markdown format,
+	// sections over it are left out with a notice. 0 disables the limit.
+	CommentSizeLimit int
+	// ResourceArgs maps resource types to their user data argument, in addition
+	// to the supported types, e.g. {"my_vm": "user_data"}.
+	ResourceArgs map[string]string
+	// Filter selects the resources, parts and write_files paths compared.
+	Filter Filter
+	// Ignore holds rules of lines dropped before diffing.
+	Ignore []IgnoreRule
+	// EffectiveContent merges write_files entries sharing a path by applying
+	// 'append', and compares the resulting file content.
+	EffectiveContent bool
+	// ShowSensitive decodes and diffs values marked sensitive in the plan
+	// instead of rendering them as "(sensitive value)".
+	ShowSensitive bool
+	// NoRedact disables redaction of secrets in decoded content.
+	NoRedact bool
+	// RedactPatterns are regular expressions of secrets redacted in addition
+	// to the built-in detectors, see NewRedactor.
+	RedactPatterns []string
+	// RedactKey is the key of the hash in redaction markers, DefaultRedactKey if empty.
+	RedactKey string
+	// NoValidate disables validation of cloud-config parts against cloud-init's schema.
+	NoValidate bool
+	// Policy holds the rules checked against resource changes, nil disables checks.
+	Policy *Policy
+	// ShowSizes shows the raw, gzip and base64 sizes of user data of each changed resource.
+	ShowSizes bool
+	// FailOnSizeLimit makes Check fail when user data is over the provider size limit.
+	FailOnSizeLimit bool
+	// Strict makes Check and CheckResult fail when write_files content after the
+	// change doesn't decode as declared by its encoding, see DecodeDiagnostic.
+	// Encodings unknown to cloud-init are reported as warnings and don't fail it.
+	Strict bool
+	// Binary is how binary content is compared: BinarySummary (the default)
+	// compares its MIME type, size and SHA-256, BinaryHex a hexdump.
+	Binary string
+	// CertExpiryDays is the number of days before expiry a certificate is
+	// reported as expiring, 0 uses 30.
+	CertExpiryDays int
+}
+
 // Diff type
 type Diff struct {
-	color *colorstring.Colorize
+	opts     Options
+	redactor *Redactor
 }
 
 // New func
+// returns a Diff with default Options.
 func New() *Diff {
-	color := &colorstring.Colorize{
-		Colors:  colorstring.DefaultColors,
-		Disable: false,
-		Reset:   true,
+	d, _ := NewWithOptions(Options{})
+	return d
+}
+
+// NewWithOptions func
+// returns a Diff configured by opts, or an error if an option is invalid.
+func NewWithOptions(opts Options) (*Diff, error) {
+	d := &Diff{opts: opts}
+	if !opts.NoRedact {
+		key := opts.RedactKey
+		if key == "" {
+			key = DefaultRedactKey
+		}
+		redactor, err := NewRedactorWithKey(key, opts.RedactPatterns...)
+		if err != nil {
+			return nil, err
+		}
+		d.redactor = redactor
 	}
-	return &Diff{color}
+	if _, err := newRenderer(opts); err != nil {
+		return nil, err
+	}
+	if err := validateBinaryMode(opts.Binary); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 // Config func
+// sets Options.NoColor.
+//
+// Deprecated: set Options.NoColor with NewWithOptions.
 func (d *Diff) Config(noColor bool) {
-	d.color.Disable = noColor
+	d.opts.NoColor = noColor
+}
+
+// DiffBlobs func
+// decodes before and after, user data encoded in base64 (gzipped or not),
+// and returns the difference between them.
+func (d *Diff) DiffBlobs(before, after string) (*Result, error) {
+	return d.diffBlobs("", before, after)
+}
+func (d *Diff) diffBlobs(address, before, after string) (*Result, error) {
+	partsA, err := toParts(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	partsB, err := toParts(after)
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+	return d.result(address, partsA, partsB), nil
+}
+
+// result returns the difference between partsA and partsB, with the policy
+// violations of every change, filtered or not.
+func (d *Diff) result(address string, partsA, partsB []*part) *Result {
+	parts := d.compareParts(address, partsA, partsB)
+	return &Result{Parts: d.filterPartDiffs(parts), Diagnostics: d.checkDecoding(address, partsA, partsB),
+		Violations: d.opts.Policy.check(address, parts)}
+}
+
+// RenderResult func
+// writes res to w in the format set in Options.
+func (d *Diff) RenderResult(w io.Writer, res *Result) error {
+	r, err := newRenderer(d.opts)
+	if err != nil {
+		return err
+	}
+	return r.RenderResult(w, res)
+}
+
+// CheckResult func
+// returns a *PolicyError if res has policy violations of severity error,
+// or a *DecodeError if Strict is set and res has decode diagnostics.
+func (d *Diff) CheckResult(res *Result) error {
+	if err := policyError(res.Violations); err != nil {
+		return err
+	}
+	return d.decodeError(res.Diagnostics)
 }
 
 // PlanChange func
-func (d *Diff) PlanChange(r io.Reader, w io.Writer, noColor bool) error {
+// reads input from r in the format 'a -> b', as output by "terraform plan" for
+// a changed argument, then compares a and b and writes diff result to w.
+// See CheckResult for the errors returned once the result is written.
+func (d *Diff) PlanChange(r io.Reader, w io.Writer) error {
 	s1, s2, err := parseInput(r)
 	if err != nil {
 		return err
 	}
-	d.Config(noColor)
-	// diffStr := diffString(deepDecode(s1), deepDecode(s2), color)
-	diffStr := d.diffParts(toParts(s1), toParts(s2))
-	_, err = w.Write([]byte(diffStr))
-	return err
+	res, err := d.DiffBlobs(s1, s2)
+	if err != nil {
+		return err
+	}
+	if err = d.RenderResult(w, res); err != nil {
+		return err
+	}
+	return d.CheckResult(res)
 }
 func parseInput(r io.Reader) (string, string, error) {
 	var err error
@@ -51,16 +182,19 @@ func parseInput(r io.Reader) (string, string, error) {
 	// _, err := fmt.Fscanf(r, "%s -> %s", &s1, &s2)
 	b, _ := ioutil.ReadAll(r)
 	parts := strings.Split(string(b), " -> ")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Input does not match format 'a -> b'")
+	}
 	s1, s2 := parts[0], parts[1]
 	if s1 == "" || s2 == "" {
 		err = fmt.Errorf("Input does not match format 'a -> b'")
 	}
-	return strings.Trim(s1, "\""), strings.Trim(s2, "\""), err
+	return strings.Trim(s1, "\""), strings.Trim(strings.TrimSpace(s2), "\""), err
 }
 
 // deepDecode decodes then gunzip, then decode base64 encoded content in YAML part (if exists)
 func deepDecode(s string) string {
-	parts := toParts(s)
+	parts, _ := toParts(s)
 	partBodies := make([][]byte, len(parts))
 	for i, part := range parts {
 		partBodies[i] = part.body
@@ -70,63 +204,109 @@ func deepDecode(s string) string {
 	}
 	return string(bytes.Join(partBodies, []byte("--boundary")))
 }
-func toParts(s string) []*part {
-	if s == "" {
-		return nil
-	}
-	data, err := base64DecodeGunzip(s)
-	if err != nil {
-		data, _ = base64Decode(s)
-	}
-	_, parts := parse(data)
-	return parts
+
+// toParts returns the parts of the user data argument s of a resource, see userDataParts.
+func toParts(s string) ([]*part, error) {
+	return userDataParts([]byte(s))
 }
-func (d *Diff) diffParts(partsA, partsB []*part) string {
-	sb := strings.Builder{}
-	for i := 0; i < len(partsA); i++ {
-		diff := d.diffPart(*partsA[i], *partsB[i])
-		if diff == "" {
-			continue
+
+// compareParts pairs parts by position; a part missing on one side is compared with an empty body.
+// Filters are not applied, so checks see every change, see filterPartDiffs.
+func (d *Diff) compareParts(address string, partsA, partsB []*part) []*PartDiff {
+	diffs := make([]*PartDiff, 0)
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var pd *PartDiff
+		switch {
+		case i >= len(partsB):
+			pd = d.comparePart(address, *partsA[i], part{header: partsA[i].header}, Delete)
+		case i >= len(partsA):
+			pd = d.comparePart(address, part{header: partsB[i].header}, *partsB[i], Create)
+		default:
+			pd = d.comparePart(address, *partsA[i], *partsB[i], Update)
+		}
+		if !pd.empty() {
+			diffs = append(diffs, pd)
 		}
-		sb.WriteString(diff)
-		sb.WriteString("\n")
 	}
-	return strings.TrimRight(sb.String(), "\n")
+	return diffs
 }
-func (d *Diff) diffPart(partA, partB part) string {
-	var diffStr string
+func (d *Diff) comparePart(address string, partA, partB part, action Action) *PartDiff {
+	header := partB.header
+	if action == Delete {
+		header = partA.header
+	}
+	pd := &PartDiff{Header: header, Action: action, EncodingBefore: partA.encoding, EncodingAfter: partB.encoding}
+	sc := scope{address: address, header: header}
 	if partA.isYAML() {
-		diffStr = d.diffYAML(string(partA.body), string(partB.body))
+		pd.Objects = d.compareYAML(sc, string(partA.body), string(partB.body))
 	} else {
-		diffStr = d.diffString(string(partA.body), string(partB.body))
+		pd.Chunks = toChunks(compareLines(d.prepare(sc, d.contentLines(string(partA.body))), d.prepare(sc, d.contentLines(string(partB.body)))))
 	}
-	if diffStr == "" {
-		return ""
+	return pd
+}
+
+// prepare returns decoded content s as it is compared: secrets redacted and ignored lines dropped.
+func (d *Diff) prepare(sc scope, s string) string {
+	return d.redactor.Redact(d.dropIgnoredLines(sc, s))
+}
+func compareLines(A, B string) []diff.Chunk {
+	if A == B {
+		return nil
 	}
+	return diff.DiffChunks(strings.Split(A, "\n"), strings.Split(B, "\n"))
+}
+func (d *Diff) diffYAML(s1, s2 string) string {
 	sb := strings.Builder{}
-	delimitedLine := fmt.Sprintf("Content-Type: %s\n", partA.header.Get("Content-Type"))
-	if val := partA.header.Get("Content-Disposition"); val != "" {
-		delimitedLine = fmt.Sprintf("Content-Disposition: %s\n", val)
-	}
-	sb.WriteString(delimitedLine)
-	sb.WriteString(diffStr)
+	NewTextRenderer(d.opts).writeObjects(&sb, d.compareYAML(scope{}, s1, s2))
 	return sb.String()
 }
-func (d *Diff) diffString(A, B string) string {
-	aLines := strings.Split(A, "\n")
-	bLines := strings.Split(B, "\n")
 
-	chunks := diff.DiffChunks(aLines, bLines)
+// contentLines returns content s as the lines it is compared by: a summary of
+// binary content, and a description of PEM certificates and keys.
+func (d *Diff) contentLines(s string) string {
+	return d.pemLines(d.binaryLines(s))
+}
 
-	return formatChunks(chunks, d.color, 2)
+// fileLines returns the content s of the file at path as the lines it is
+// compared by, for files with a format compared by meaning.
+func fileLines(path, s string) string {
+	switch {
+	case strings.HasSuffix(path, "authorized_keys"):
+		return authorizedKeysLines(s)
+	case isUnitFile(path):
+		return unitLines(s)
+	}
+	return s
 }
-func (d *Diff) diffYAML(s1, s2 string) string {
-	m1, m2 := toMapPreserveStyle(s1), toMapPreserveStyle(s2)
-	sb := strings.Builder{}
-	for _, obj := range diffMap(m1, m2) {
-		sb.WriteString(obj.toString(d.color))
+func (d *Diff) compareYAML(sc scope, s1, s2 string) []*Object {
+	m1, encodings1 := toMapPreserveStyle(s1, d.opts.EffectiveContent)
+	m2, encodings2 := toMapPreserveStyle(s2, d.opts.EffectiveContent)
+	for _, m := range []map[fileKey]map[string]interface{}{m1, m2} {
+		for key, object := range m {
+			fileScope := sc
+			fileScope.path = key.path
+			for k, v := range object {
+				value := toString(v)
+				if k == "content" {
+					value = fileLines(key.path, d.contentLines(value))
+				}
+				object[k] = d.prepare(fileScope, value)
+			}
+		}
 	}
-	return sb.String()
+	objs := diffMap(m1, m2)
+	for _, obj := range objs {
+		key := fileKey{obj.Path, obj.Occurrence}
+		obj.EncodingBefore, obj.EncodingAfter = encodings1[key], encodings2[key]
+		if isUnitFile(obj.Path) {
+			obj.Fields = unitObjectFields(obj.Fields, m1[key], m2[key])
+		}
+	}
+	objs = append(d.compareIdentities(sc, s1, s2), objs...)
+	if keys := d.compareKeys(sc, s1, s2); keys != nil {
+		objs = append([]*Object{keys}, objs...)
+	}
+	return objs
 }
 func toMap(s string) map[string]map[string]interface{} {
 	data := []byte(s)
@@ -146,13 +326,51 @@ func toMap(s string) map[string]map[string]interface{} {
 	}
 	return pathToContent
 }
-func toMapPreserveStyle(s string) map[string]map[string]interface{} {
+
+// fileKey identifies a write_files entry by its path and by the number of
+// entries with the same path before it, so a repeated path (e.g. a base file
+// followed by an 'append: true' entry) does not overwrite the previous one.
+type fileKey struct {
+	path       string
+	occurrence int
+}
+
+func (k fileKey) less(other fileKey) bool {
+	if k.path != other.path {
+		return k.path < other.path
+	}
+	return k.occurrence < other.occurrence
+}
+
+// writeFile is a write_files entry, attrs holds every key except path.
+type writeFile struct {
+	key   fileKey
+	attrs map[string]interface{}
+	// encoding is the chain of encodings decoded to get the content.
+	encoding EncodingChain
+	// decodeErr is set when the content doesn't decode as declared.
+	decodeErr error
+}
+
+// isAppend reports whether the append key of f is true, spelled in any way
+// cloud-init accepts: YAML 1.1 booleans like yes or on, quoted or not, y or 1.
+func (f writeFile) isAppend() bool {
+	switch strings.ToLower(strings.TrimSpace(strings.Trim(toString(f.attrs["append"]), "\"'"))) {
+	case "true", "yes", "on", "y", "1":
+		return true
+	}
+	return false
+}
+
+// toWriteFiles returns write_files entries in document order, with content decoded.
+func toWriteFiles(s string) []writeFile {
 	document := yaml.Node{}
 	err := yaml.Unmarshal([]byte(s), &document)
 	if err != nil {
 		return nil
 	}
-	pathToObject := make(map[string]map[string]interface{})
+	files := make([]writeFile, 0)
+	occurrences := make(map[string]int)
 	for _, node := range document.Content {
 		if node.Kind == yaml.MappingNode {
 			seqNode := getNodeByKey(node, "write_files")
@@ -172,15 +390,67 @@ func toMapPreserveStyle(s string) map[string]map[string]interface{} {
 							object[key] = value
 						}
 					}
+					var encoding EncodingChain
+					var decodeErr error
 					if _, ok := object["content"]; ok {
-						object["content"], _ = decode(toString(object["content"]), toString(object["encoding"]))
+						encodingType := ""
+						if v, ok := object["encoding"]; ok {
+							encodingType = strings.Trim(toString(v), "\"'")
+						}
+						object["content"], encoding, decodeErr = decode(toString(object["content"]), encodingType)
 					}
-					pathToObject[path] = object
+					files = append(files, writeFile{fileKey{path, occurrences[path]}, object, encoding, decodeErr})
+					occurrences[path]++
 				}
 			}
 		}
 	}
-	return pathToObject
+	return files
+}
+
+// effectiveWriteFiles merges entries sharing a path into the file cloud-init
+// leaves on disk: an 'append: true' entry adds its content to the previous one,
+// any other entry replaces it. Attributes of the last entry win.
+func effectiveWriteFiles(files []writeFile) []writeFile {
+	effective := make([]writeFile, 0, len(files))
+	index := make(map[string]int)
+	for _, f := range files {
+		object := make(map[string]interface{}, len(f.attrs))
+		for k, v := range f.attrs {
+			if k != "append" {
+				object[k] = v
+			}
+		}
+		i, ok := index[f.key.path]
+		if !ok {
+			index[f.key.path] = len(effective)
+			effective = append(effective, writeFile{fileKey{f.key.path, 0}, object, f.encoding, f.decodeErr})
+			continue
+		}
+		if f.isAppend() {
+			object["content"] = toString(effective[i].attrs["content"]) + toString(object["content"])
+		}
+		effective[i].attrs, effective[i].encoding = object, f.encoding
+	}
+	return effective
+}
+
+// toMapPreserveStyle returns write_files entries keyed by path and occurrence,
+// and the encodings of their content. Archives are expanded, see expandArchives.
+// If effective is set, entries of the same path are merged, see effectiveWriteFiles.
+func toMapPreserveStyle(s string, effective bool) (map[fileKey]map[string]interface{}, map[fileKey]EncodingChain) {
+	files := toWriteFiles(s)
+	if effective {
+		files = effectiveWriteFiles(files)
+	}
+	files = expandArchives(files)
+	keyToObject := make(map[fileKey]map[string]interface{}, len(files))
+	keyToEncoding := make(map[fileKey]EncodingChain, len(files))
+	for _, f := range files {
+		keyToObject[f.key] = f.attrs
+		keyToEncoding[f.key] = f.encoding
+	}
+	return keyToObject, keyToEncoding
 }
 func valueWithStyle(node *yaml.Node) string {
 	value := node.Value
@@ -192,39 +462,6 @@ func valueWithStyle(node *yaml.Node) string {
 	}
 	return value
 }
-func formatChunks(chunks []diff.Chunk, color *colorstring.Colorize, indentSize int) string {
-	buf := new(bytes.Buffer)
-	indent := strings.Repeat(" ", indentSize)
-	oidx, nidx := 1, 1
-	padding := 5
-	for _, c := range chunks {
-		for _, line := range c.Added {
-			fmt.Fprintf(buf, fmt.Sprintf("%*s|%-*d ", padding, " ", padding, nidx)+color.Color(diffActionSymbol(Create)+fmt.Sprintf("%s%s\n", indent, line)))
-			nidx++
-		}
-		for _, line := range c.Deleted {
-			fmt.Fprintf(buf, fmt.Sprintf("%*d|%*s ", padding, oidx, padding, " ")+color.Color(diffActionSymbol(Delete)+fmt.Sprintf("%s%s\n", indent, line)))
-			oidx++
-		}
-		delimitedLine := indent + " ...\n"
-		if len(c.Equal) > 0 {
-			fmt.Fprint(buf, delimitedLine)
-		}
-		oidx += len(c.Equal)
-		nidx += len(c.Equal)
-	}
-	return buf.String()
-}
-func diffActionSymbol(action Action) string {
-	switch action {
-	case Create:
-		return "[green]" + string(Create)
-	case Delete:
-		return "[red]" + string(Delete)
-	default:
-		return " "
-	}
-}
 func skipLine(n, i int, line string) bool {
 	appendLines := 5
 	r, _ := regexp.Compile("(^[ ]+[a-z]+): (.+)")
@@ -1,13 +1,11 @@
 package diff
 
 import (
-	"bytes"
 	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/kylelemons/godebug/diff"
-	"github.com/mitchellh/colorstring"
 )
 
 // Action is a action type for a resource change.
@@ -24,48 +22,8 @@ const (
 	Delete Action = '-'
 )
 
-type object struct {
-	key       string
-	diffType  Action
-	keychunks []keychunk
-}
-
-func (obj object) toString(color *colorstring.Colorize) string {
-	buf := new(bytes.Buffer)
-	fmt.Fprintf(buf, color.Color(fmt.Sprintf(diffActionSymbol(obj.diffType)+"- path: %s\n", obj.key)))
-	for _, chunks := range obj.keychunks {
-		fmt.Fprintf(buf, chunks.toString(color, 2))
-	}
-	return buf.String()
-}
-
-type keychunk struct {
-	key          string
-	chunks       []diff.Chunk
-	isBlockStyle bool
-	diffType     Action
-}
-
-func (kc keychunk) toString(color *colorstring.Colorize, indentSize int) string {
-	sb := strings.Builder{}
-	indent := strings.Repeat(" ", indentSize)
-	if !kc.isBlockStyle {
-		for _, c := range kc.chunks {
-			for _, line := range c.Added {
-				sb.WriteString(color.Color(diffActionSymbol(Create) + fmt.Sprintf("%s%s: %s\n", indent, kc.key, line)))
-			}
-			for _, line := range c.Deleted {
-				sb.WriteString(color.Color(diffActionSymbol(Delete) + fmt.Sprintf("%s%s: %s\n", indent, kc.key, line)))
-			}
-		}
-	} else {
-		sb.WriteString(color.Color(diffActionSymbol(kc.diffType) + fmt.Sprintf("%s%s:\n", indent, kc.key)))
-		sb.WriteString(formatChunks(kc.chunks, color, indentSize+2))
-	}
-	return sb.String()
-}
-func diffMapToChunks(m1, m2 map[string]interface{}) []keychunk {
-	diffs := make([]keychunk, 0)
+func diffMapToChunks(m1, m2 map[string]interface{}) []*Field {
+	diffs := make([]*Field, 0)
 	for k1, v1 := range m1 {
 		// at this time, treat every value as string to compare
 		a := strings.Split(strings.TrimRight(toString(v1), "\n"), "\n")
@@ -74,22 +32,22 @@ func diffMapToChunks(m1, m2 map[string]interface{}) []keychunk {
 			b := strings.Split(strings.TrimRight(toString(v2), "\n"), "\n")
 			chunks := diff.DiffChunks(a, b)
 			if len(chunks) > 0 {
-				diffs = append(diffs, keychunk{k1, chunks, isBlockStyle || len(b) > 1, Update})
+				diffs = append(diffs, &Field{k1, Update, toChunks(chunks), isBlockStyle || len(b) > 1})
 			}
 		} else {
 			chunks := diff.DiffChunks(a, nil)
-			diffs = append(diffs, keychunk{k1, chunks, isBlockStyle, Delete})
+			diffs = append(diffs, &Field{k1, Delete, toChunks(chunks), isBlockStyle})
 		}
 	}
 	for k2, v2 := range m2 {
 		if _, ok := m1[k2]; !ok {
-			b := strings.Split(strings.TrimRight(v2.(string), "\n"), "\n")
+			b := strings.Split(strings.TrimRight(toString(v2), "\n"), "\n")
 			chunks := diff.DiffChunks(nil, b)
-			diffs = append(diffs, keychunk{k2, chunks, len(b) > 1, Create})
+			diffs = append(diffs, &Field{k2, Create, toChunks(chunks), len(b) > 1})
 		}
 	}
 	sort.SliceStable(diffs, func(i, j int) bool {
-		return diffs[i].key < diffs[j].key
+		return diffs[i].Key < diffs[j].Key
 	})
 	return diffs
 }
@@ -97,25 +55,25 @@ func diffMapToChunks(m1, m2 map[string]interface{}) []keychunk {
 func toString(in interface{}) string {
 	return fmt.Sprint(in)
 }
-func diffMap(m1, m2 map[string]map[string]interface{}) []object {
-	objs := make([]object, 0)
+func diffMap(m1, m2 map[fileKey]map[string]interface{}) []*Object {
+	objs := make([]*Object, 0)
 	for k1, v1 := range m1 {
 		if v2, ok := m2[k1]; ok {
 			chunks := diffMapToChunks(v1, v2)
 			if len(chunks) > 0 {
-				objs = append(objs, object{k1, Update, chunks})
+				objs = append(objs, &Object{Path: k1.path, Occurrence: k1.occurrence, Action: Update, Fields: chunks})
 			}
 		} else {
-			objs = append(objs, object{k1, Delete, diffMapToChunks(v1, nil)})
+			objs = append(objs, &Object{Path: k1.path, Occurrence: k1.occurrence, Action: Delete, Fields: diffMapToChunks(v1, nil)})
 		}
 	}
 	for k2, v2 := range m2 {
 		if _, ok := m1[k2]; !ok {
-			objs = append(objs, object{k2, Create, diffMapToChunks(nil, v2)})
+			objs = append(objs, &Object{Path: k2.path, Occurrence: k2.occurrence, Action: Create, Fields: diffMapToChunks(nil, v2)})
 		}
 	}
 	sort.SliceStable(objs, func(i, j int) bool {
-		return objs[i].key < objs[j].key
+		return fileKey{objs[i].Path, objs[i].Occurrence}.less(fileKey{objs[j].Path, objs[j].Occurrence})
 	})
 	return objs
 }
@@ -1,7 +1,9 @@
 package diff
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,9 +57,11 @@ func TestDiffYAML_OnePath_Encoding(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			actual := d.diffYAML(buildYAML(tt.m1), buildYAML(tt.m2))
-			if !assert.Equal(t, buildDiff(tt.expect), actual) {
+			// the encoding decoded is reported next to the path
+			expect := strings.Replace(buildDiff(tt.expect), "selinux\n", "selinux  # encoding: base64\n", 1)
+			if !assert.Equal(t, expect, actual) {
 				fmt.Println(actual)
-				fmt.Println(buildDiff(tt.expect))
+				fmt.Println(expect)
 			}
 		})
 	}
@@ -136,3 +140,145 @@ func buildDiff(a string) string {
 %s
 `, a)
 }
+
+func TestDiffYAML_DuplicatePath(t *testing.T) {
+	base := `
+write_files:
+- path: /etc/crontab
+  encoding: text/plain
+  content: |
+    0 * * * * root backup
+- path: /etc/crontab
+  append: true
+  encoding: text/plain
+  content: |
+    15 * * * * root ship_logs
+`
+	changed := `
+write_files:
+- path: /etc/crontab
+  encoding: text/plain
+  content: |
+    0 * * * * root backup
+- path: /etc/crontab
+  append: true
+  encoding: text/plain
+  content: |
+    30 * * * * root ship_logs
+`
+	tests := []struct {
+		name      string
+		effective bool
+		expect    string
+	}{
+		{"per occurrence", false, ` - path: /etc/crontab  # occurrence 2
+-  content: 15 * * * * root ship_logs
++  content: 30 * * * * root ship_logs
+`},
+		{"effective content", true, ` - path: /etc/crontab
+   content:
+     ...
+    2|      -    15 * * * * root ship_logs
+     |2     +    30 * * * * root ship_logs
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := NewWithOptions(Options{NoColor: true, EffectiveContent: tt.effective})
+			actual := d.diffYAML(base, changed)
+			if !assert.Equal(t, tt.expect, actual) {
+				fmt.Println(actual)
+			}
+		})
+	}
+}
+
+func TestEffectiveWriteFiles(t *testing.T) {
+	files := toWriteFiles(`
+write_files:
+- path: /etc/motd
+  encoding: text/plain
+  content: first
+  owner: root:root
+- path: /etc/motd
+  encoding: text/plain
+  content: |
+    second
+  owner: root:user
+- path: /etc/motd
+  append: true
+  encoding: text/plain
+  content: |
+    third
+`)
+	effective := effectiveWriteFiles(files)
+	assert.Len(t, files, 3)
+	assert.Equal(t, []writeFile{{fileKey{"/etc/motd", 0}, map[string]interface{}{"encoding": "text/plain", "content": "second\nthird\n"}, EncodingChain{}, nil}}, effective)
+}
+
+func TestWriteFile_IsAppend(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect bool
+	}{
+		{"true", true},
+		{"True", true},
+		{"yes", true},
+		{"on", true},
+		{"'Yes'", true},
+		{"1", true},
+		{"false", false},
+		{"no", false},
+		{"off", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			files := toWriteFiles("write_files:\n- path: /etc/motd\n  content: first\n- path: /etc/motd\n  append: " + tt.value + "\n  content: second\n")
+			assert.Equal(t, tt.expect, files[1].isAppend())
+			expect := "second"
+			if tt.expect {
+				expect = "firstsecond"
+			}
+			assert.Equal(t, expect, effectiveWriteFiles(files)[0].attrs["content"])
+		})
+	}
+}
+
+func TestDiffBlobs(t *testing.T) {
+	userData := func(script string) string {
+		doc := "Content-Type: multipart/mixed; boundary=\"B\"\r\n\r\n--B\r\nContent-Type: text/x-shellscript\r\n\r\n" + script + "\r\n--B--\r\n"
+		b, _ := gzipData([]byte(doc))
+		return base64Encode(b)
+	}
+	before := userData("echo one\necho two\necho three\necho four")
+	after := userData("echo one\necho two\necho 3\necho four")
+	tests := []struct {
+		name    string
+		context int
+		expect  string
+	}{
+		{"no context", 0, "Content-Type: text/x-shellscript  # encoding: base64+gzip\n   ...\n    3|      -  echo three\n     |3     +  echo 3\n   ..."},
+		{"one line of context", 1, "Content-Type: text/x-shellscript  # encoding: base64+gzip\n   ...\n    2|2        echo two\n    3|      -  echo three\n     |3     +  echo 3\n    4|4        echo four"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewWithOptions(Options{NoColor: true, Context: tt.context})
+			assert.NoError(t, err)
+			res, err := d.DiffBlobs(before, after)
+			assert.NoError(t, err)
+			assert.Len(t, res.Parts, 1)
+			assert.Equal(t, "text/x-shellscript", res.Parts[0].Name())
+			var buf bytes.Buffer
+			assert.NoError(t, d.RenderResult(&buf, res))
+			assert.Equal(t, tt.expect, buf.String())
+		})
+	}
+}
+
+func TestNewWithOptions_Invalid(t *testing.T) {
+	_, err := NewWithOptions(Options{RedactPatterns: []string{"("}})
+	assert.Error(t, err)
+	_, err = NewWithOptions(Options{Format: "pdf"})
+	assert.Error(t, err)
+}
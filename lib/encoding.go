@@ -5,24 +5,92 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 )
 
-// decode func performs string decoding, then return.
+// decode func performs string decoding by the declared encodingType, and
+// returns the content with the chain of encodings.
 // Supported encoding types are: gz, gzip, gz+base64, gzip+base64, gz+b64, gzip+b64, b64, base64, text/plain
-// if encondingType is 'text/plain', just return s
-func decode(s, encodingType string) (string, error) {
+// encodingType is lowercased and trimmed, as cloud-init does.
+// if encodingType is supported, the content is decoded as declared only, as
+// cloud-init writes it; 'text/plain' is kept as is.
+// if encodingType is empty or unknown, the content is kept as is too, as
+// cloud-init writes it as text/plain; the encodings detected, see
+// detectEncoding, are only reported in the error, wrapping errUnknownEncoding.
+// if the declared decoding fails, the error is returned with s as is, as
+// cloud-init would write it.
+func decode(s, encodingType string) (string, EncodingChain, error) {
+	encodingType = strings.ToLower(strings.TrimSpace(encodingType))
+	v, chain, err := decodeDeclared(s, encodingType)
+	switch {
+	case errors.Is(err, errUnknownEncoding):
+		if _, detected := detectEncoding([]byte(s)); len(detected) > 0 {
+			err = fmt.Errorf("%w, content looks like %s", err, detected)
+		}
+		return s, EncodingChain{}, err
+	case err != nil:
+		return s, EncodingChain{}, err
+	case encodingType == "":
+		if _, detected := detectEncoding(v); len(detected) > 0 {
+			return s, EncodingChain{}, fmt.Errorf("no encoding declared but content looks like %s, %w", detected, errUnknownEncoding)
+		}
+	}
+	return string(v), chain, nil
+}
+
+// errUnknownEncoding is returned by decode for content cloud-init writes as
+// text/plain although it isn't: an encoding it doesn't support, or encoded
+// content without an encoding declared.
+var errUnknownEncoding = errors.New("cloud-init writes it as text/plain")
+
+// decodeDeclared decodes s by encodingType, and returns a DecodeDiagnostic
+// message as error if it fails, e.g. "encoding b64 declared but content is
+// not valid base64 at offset 120".
+func decodeDeclared(s, encodingType string) ([]byte, EncodingChain, error) {
+	var v []byte
+	var chain EncodingChain
 	var err error
-	v := []byte(s)
 	switch encodingType {
 	case "b64", "base64":
+		chain = EncodingChain{"base64"}
 		v, err = base64Decode(s)
+		err = base64DecodeError(err)
 	case "gz", "gzip":
+		chain = EncodingChain{"gzip"}
 		v, err = gunzipData([]byte(s))
-	case "text/plain":
+		err = gzipDecodeError(err)
+	case "gz+base64", "gzip+base64", "gz+b64", "gzip+b64":
+		chain = EncodingChain{"base64", "gzip"}
+		if v, err = base64Decode(s); err != nil {
+			err = base64DecodeError(err)
+		} else {
+			v, err = gunzipData(v)
+			err = gzipDecodeError(err)
+		}
+	case "", "text/plain":
+		return []byte(s), EncodingChain{}, nil
 	default:
-		v, err = base64DecodeGunzip(s)
+		return []byte(s), EncodingChain{}, fmt.Errorf("unknown encoding %s, %w", encodingType, errUnknownEncoding)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding %s declared but %w", encodingType, err)
+	}
+	return v, chain, nil
+}
+
+func base64DecodeError(err error) error {
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return fmt.Errorf("content is not valid base64 at offset %d", int64(corrupt))
+	}
+	return err
+}
+func gzipDecodeError(err error) error {
+	if err != nil {
+		return fmt.Errorf("content is not valid gzip: %v", err)
 	}
-	return string(v), err
+	return nil
 }
 
 // base64DecodeGunzip decodes a string containing a base64 sequence and then uncompresses the result with gzip
@@ -0,0 +1,102 @@
+package diff
+
+import "net/textproto"
+
+// Filter selects the resources, parts and write_files paths that are shown.
+// The policy, schema and decoding checks still see every part and path, and
+// the policy every resource.
+// Each field holds globs in path.Match syntax, a value equal to a glob also
+// matches (e.g. addresses with an index, "aws_instance.web[0]").
+// An empty include list matches anything; a value matching an exclude glob is
+// always left out.
+type Filter struct {
+	// Resources and ExcludeResources match the resource address.
+	Resources, ExcludeResources []string
+	// Types and ExcludeTypes match the resource type.
+	Types, ExcludeTypes []string
+	// Parts and ExcludeParts match the file name of the MIME part, or its Content-Type.
+	Parts, ExcludeParts []string
+	// Paths and ExcludePaths match the write_files path. When Paths is set,
+	// only write_files entries are compared, other parts are left out.
+	Paths, ExcludePaths []string
+}
+
+// matchResource reports whether the resource at address, of type typ, is shown.
+func (f Filter) matchResource(address, typ string) bool {
+	return matchGlobs(f.Resources, f.ExcludeResources, address) && matchGlobs(f.Types, f.ExcludeTypes, typ)
+}
+
+// matchPart reports whether a part is compared, by its file name or Content-Type.
+func (f Filter) matchPart(header textproto.MIMEHeader) bool {
+	return matchGlobs(f.Parts, f.ExcludeParts, partName(header), header.Get("Content-Type"))
+}
+
+// matchPath reports whether a write_files entry is compared.
+func (f Filter) matchPath(path string) bool {
+	return matchGlobs(f.Paths, f.ExcludePaths, path)
+}
+
+// filterPart returns pd with the write_files entries left out by f removed,
+// or nil if the whole part is left out.
+func (f Filter) filterPart(pd *PartDiff) *PartDiff {
+	if !f.matchPart(pd.Header) {
+		return nil
+	}
+	if pd.Objects == nil {
+		if len(f.Paths) > 0 {
+			return nil
+		}
+		return pd
+	}
+	objects := make([]*Object, 0, len(pd.Objects))
+	for _, obj := range pd.Objects {
+		// users and groups entries and cloud-config keys are left out like other parts
+		if obj.isFile() && f.matchPath(obj.Path) || !obj.isFile() && len(f.Paths) == 0 {
+			objects = append(objects, obj)
+		}
+	}
+	pd.Objects = objects
+	return pd
+}
+
+// matchGlobs reports whether one of values matches an include glob, or there
+// is none, and no value matches an exclude glob.
+func matchGlobs(include, exclude []string, values ...string) bool {
+	for _, pattern := range exclude {
+		if pattern == "" {
+			continue
+		}
+		for _, v := range values {
+			if matchGlob(pattern, v) {
+				return false
+			}
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		for _, v := range values {
+			if matchGlob(pattern, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether s matches pattern, or is equal to it.
+func matchGlob(pattern, s string) bool {
+	return s == pattern || globMatch(pattern, s)
+}
+
+// filterPartDiffs returns the part diffs left by the part and path filters, for rendering.
+func (d *Diff) filterPartDiffs(parts []*PartDiff) []*PartDiff {
+	filtered := make([]*PartDiff, 0, len(parts))
+	for _, pd := range parts {
+		if pd = d.opts.Filter.filterPart(pd); pd != nil && !pd.empty() {
+			filtered = append(filtered, pd)
+		}
+	}
+	return filtered
+}
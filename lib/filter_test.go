@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_MatchResource(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		address string
+		expect  bool
+	}{
+		{"no filter", Filter{}, "aws_instance.web", true},
+		{"module glob", Filter{Resources: []string{"module.app.*"}}, "module.app.aws_instance.web", true},
+		{"other module", Filter{Resources: []string{"module.app.*"}}, "module.db.aws_instance.web", false},
+		{"exact address with index", Filter{Resources: []string{"aws_instance.web[0]"}}, "aws_instance.web[0]", true},
+		{"excluded", Filter{Resources: []string{"module.app.*"}, ExcludeResources: []string{"*.bastion"}}, "module.app.aws_instance.bastion", false},
+		{"type", Filter{Types: []string{"aws_launch_template"}}, "aws_instance.web", false},
+		{"excluded type", Filter{ExcludeTypes: []string{"aws_*"}}, "aws_instance.web", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, tt.filter.matchResource(tt.address, "aws_instance"))
+		})
+	}
+}
+
+func TestFilter_FilterPart(t *testing.T) {
+	d := New()
+	cloudConfig := func() *PartDiff {
+		return &PartDiff{Header: textproto.MIMEHeader{
+			"Content-Type":        {"text/cloud-config"},
+			"Content-Disposition": {`attachment; filename="app.cfg"`},
+		}, Objects: d.compareYAML(scope{}, "", "write_files:\n- path: /etc/nginx/nginx.conf\n- path: /etc/motd")}
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		part   *PartDiff
+		expect []string
+	}{
+		{"no filter", Filter{}, cloudConfig(), []string{"/etc/motd", "/etc/nginx/nginx.conf"}},
+		{"part by file name", Filter{Parts: []string{"*.cfg"}}, cloudConfig(), []string{"/etc/motd", "/etc/nginx/nginx.conf"}},
+		{"part by content type", Filter{ExcludeParts: []string{"text/cloud-config"}}, cloudConfig(), nil},
+		{"path", Filter{Paths: []string{"/etc/nginx/*"}}, cloudConfig(), []string{"/etc/nginx/nginx.conf"}},
+		{"excluded path", Filter{ExcludePaths: []string{"/etc/motd"}}, cloudConfig(), []string{"/etc/nginx/nginx.conf"}},
+		{"path leaves out scripts", Filter{Paths: []string{"/etc/*"}}, testResult().Parts[0], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd := tt.filter.filterPart(tt.part)
+			if tt.expect == nil {
+				assert.Nil(t, pd)
+				return
+			}
+			paths := make([]string, 0)
+			for _, obj := range pd.Objects {
+				paths = append(paths, obj.Path)
+			}
+			assert.Equal(t, tt.expect, paths)
+		})
+	}
+}
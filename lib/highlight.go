@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"html"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// highlightPatterns holds a regular expression per language, whose named groups
+// are the token classes of the HTML format: comment, string, keyword, variable, key, section.
+var highlightPatterns = map[string]*regexp.Regexp{
+	"shell": regexp.MustCompile(`(?P<comment>(?:^|[ \t])#.*$)|(?P<string>"(?:[^"\\]|\\.)*"|'[^']*')|(?P<variable>\$\{?[A-Za-z_][A-Za-z0-9_]*\}?)|` +
+		`(?P<keyword>\b(?:if|then|else|elif|fi|for|while|until|do|done|case|esac|function|in|return|export|local|set|exit)\b)`),
+	"yaml": regexp.MustCompile(`(?P<comment>(?:^|[ \t])#.*$)|(?P<key>^\s*(?:- )?[\w./-]+:(?:\s|$))|(?P<string>"(?:[^"\\]|\\.)*"|'[^']*')|` +
+		`(?P<keyword>\b(?:true|false|null|yes|no)\b)`),
+	"json": regexp.MustCompile(`(?P<key>"(?:[^"\\]|\\.)*"\s*:)|(?P<string>"(?:[^"\\]|\\.)*")|(?P<keyword>\b(?:true|false|null)\b)`),
+	"python": regexp.MustCompile(`(?P<comment>#.*$)|(?P<string>"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')|` +
+		`(?P<keyword>\b(?:def|class|import|from|as|if|elif|else|for|while|in|return|with|try|except|finally|raise|None|True|False)\b)`),
+	// a key may follow its section on the same line, see unitLines
+	"ini": regexp.MustCompile(`(?P<comment>^\s*[#;].*$)|(?P<key>^\s*(?:\[[^\]]*\]\s+)?[\w.-]+\s*=)|(?P<section>^\s*\[[^\]]*\])`),
+}
+
+// highlightExtensions maps file extensions to languages of highlightPatterns.
+var highlightExtensions = map[string]string{
+	".sh": "shell", ".bash": "shell", ".yaml": "yaml", ".yml": "yaml", ".json": "json", ".py": "python",
+	".ini": "ini", ".conf": "ini", ".cfg": "ini", ".service": "ini", ".socket": "ini", ".timer": "ini",
+	".mount": "ini", ".target": "ini", ".network": "ini", ".netdev": "ini",
+}
+
+// highlightContentTypes maps MIME part Content-Types to languages of highlightPatterns.
+var highlightContentTypes = map[string]string{
+	"text/x-shellscript": "shell", "text/cloud-boothook": "shell", "text/cloud-config": "yaml",
+	"text/cloud-config-archive": "yaml", "application/json": "json",
+}
+
+// highlightLanguage returns the language of a file from its name, or from the
+// Content-Type of its part if the extension is unknown; "" if neither is known.
+func highlightLanguage(contentType, filename string) string {
+	if lang, ok := highlightExtensions[strings.ToLower(path.Ext(filename))]; ok {
+		return lang
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return highlightContentTypes[strings.ToLower(mediaType)]
+}
+
+// highlight returns line, HTML escaped, with its tokens wrapped in spans
+// classed by token type.
+func highlight(lang, line string) string {
+	re, ok := highlightPatterns[lang]
+	if !ok {
+		return html.EscapeString(line)
+	}
+	names := re.SubexpNames()
+	sb := strings.Builder{}
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(line, -1) {
+		for i := 1; i < len(names); i++ {
+			if m[2*i] < 0 {
+				continue
+			}
+			sb.WriteString(html.EscapeString(line[last:m[0]]))
+			sb.WriteString(`<span class="hl-` + names[i] + `">` + html.EscapeString(line[m[0]:m[1]]) + `</span>`)
+			last = m[1]
+			break
+		}
+	}
+	sb.WriteString(html.EscapeString(line[last:]))
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRule drops the lines matching Lines from decoded content before it is
+// compared, so known-noisy lines (e.g. build timestamps) don't show as changes.
+// Resource, Part and Path scope the rule, they are globs in path.Match syntax
+// (a value equal to the glob also matches) and an empty glob matches anything.
+type IgnoreRule struct {
+	// Resource matches the resource address.
+	Resource string
+	// Part matches the file name of the MIME part, or its Content-Type.
+	Part string
+	// Path matches the write_files path; a rule with Path set only applies to write_files.
+	Path  string
+	Lines *regexp.Regexp
+}
+
+// scope locates decoded content: the resource, the MIME part and the write_files path, if any.
+type scope struct {
+	address string
+	header  textproto.MIMEHeader
+	path    string
+}
+
+func (rule IgnoreRule) match(sc scope) bool {
+	if rule.Path != "" && sc.path == "" {
+		return false
+	}
+	partMatch := matchGlob(rule.Part, partName(sc.header)) || matchGlob(rule.Part, sc.header.Get("Content-Type"))
+	return partMatch && matchGlob(rule.Resource, sc.address) && matchGlob(rule.Path, sc.path)
+}
+
+// dropIgnoredLines removes from s the lines matched by the ignore rules of sc.
+func (d *Diff) dropIgnoredLines(sc scope, s string) string {
+	rules := make([]IgnoreRule, 0)
+	for _, rule := range d.opts.Ignore {
+		if rule.Lines != nil && rule.match(sc) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		ignored := false
+		for _, rule := range rules {
+			if rule.Lines.MatchString(line) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// LoadIgnore func
+// reads ignore rules in the .diffdecodingignore format from r: each line is a
+// regular expression of lines to drop, taken as is, spaces included. A line
+// "@resource=<glob> part=<glob> path=<glob>" scopes the following expressions,
+// until the next one, and a line "@" alone scopes them everywhere again, as are
+// expressions before the first scope. Blank lines and lines starting with "#"
+// are skipped, start an expression with "\#" or "\@" to match a literal "#" or "@".
+func LoadIgnore(r io.Reader) ([]IgnoreRule, error) {
+	rules := make([]IgnoreRule, 0)
+	var current IgnoreRule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "@"):
+			scoped, err := parseIgnoreScope(line[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			current = scoped
+		default:
+			re, err := regexp.Compile(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			rule := current
+			rule.Lines = re
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// parseIgnoreScope parses the "key=glob" pairs of a scope line of an ignore file.
+func parseIgnoreScope(s string) (IgnoreRule, error) {
+	var rule IgnoreRule
+	for _, field := range strings.Fields(s) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return rule, fmt.Errorf("invalid scope %q, must be key=glob", field)
+		}
+		switch kv[0] {
+		case "resource":
+			rule.Resource = kv[1]
+		case "part":
+			rule.Part = kv[1]
+		case "path":
+			rule.Path = kv[1]
+		default:
+			return rule, fmt.Errorf("unknown scope key %q, must be one of resource, part, path", kv[0])
+		}
+	}
+	return rule, nil
+}
@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testIgnore = `
+# build metadata changes on every plan
+^BUILD_ID=
+
+@resource=module.app.* part=*.sh
+\# rendered at .*
+@path=/etc/motd
+^Built on
+`
+
+func TestLoadIgnore(t *testing.T) {
+	rules, err := LoadIgnore(strings.NewReader(testIgnore))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+	assert.Equal(t, IgnoreRule{}, IgnoreRule{Resource: rules[0].Resource, Part: rules[0].Part, Path: rules[0].Path})
+	assert.Equal(t, "^BUILD_ID=", rules[0].Lines.String())
+	assert.Equal(t, "module.app.*", rules[1].Resource)
+	assert.Equal(t, "*.sh", rules[1].Part)
+	assert.True(t, rules[1].Lines.MatchString("# rendered at 2022-01-01"))
+	assert.Equal(t, "/etc/motd", rules[2].Path)
+	assert.Equal(t, "", rules[2].Resource)
+
+	// character classes are expressions, "@" alone scopes them everywhere again
+	rules, err = LoadIgnore(strings.NewReader("@path=/etc/motd\n^Built on\n@\n[0-9a-f]{40}\n[abc]\n^  - \n"))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 4)
+	rules = rules[1:]
+	assert.Equal(t, IgnoreRule{}, IgnoreRule{Resource: rules[0].Resource, Part: rules[0].Part, Path: rules[0].Path})
+	assert.True(t, rules[0].Lines.MatchString("commit "+strings.Repeat("a1", 20)))
+	assert.Equal(t, "[abc]", rules[1].Lines.String())
+	assert.True(t, rules[1].Lines.MatchString("b"))
+	// spaces belong to the expression
+	assert.Equal(t, "^  - ", rules[2].Lines.String())
+	assert.False(t, rules[2].Lines.MatchString("  -x"))
+
+	for _, in := range []string{"(", "@resource", "@owner=root", "[0-9"} {
+		_, err := LoadIgnore(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}
+
+func TestPlanJSON_Ignore(t *testing.T) {
+	rules, _ := LoadIgnore(strings.NewReader(testIgnore))
+	tests := []struct {
+		name          string
+		before, after string
+		expect        string
+	}{
+		{"only ignored lines changed", "BUILD_ID=1\necho one", "BUILD_ID=2\necho one", ""},
+		{"other lines changed", "BUILD_ID=1\necho one", "BUILD_ID=2\necho two", "@@ aws_instance.this\n   size: payload 182 B -> 184 B (+2 B)\nContent-Type: text/x-shellscript  # encoding: base64+gzip\n    1|      -  echo one\n     |1     +  echo two"},
+		{"out of scope", "# rendered at 1", "# rendered at 2", "@@ aws_instance.this\n   size: payload 177 B -> 178 B (+1 B)\nContent-Type: text/x-shellscript  # encoding: base64+gzip\n    1|      -  # rendered at 1\n     |1     +  # rendered at 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := NewWithOptions(Options{NoColor: true, Ignore: rules})
+			var buf bytes.Buffer
+			err := d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+				"before": map[string]interface{}{"user_data_base64": buildUserData(tt.before)},
+				"after":  map[string]interface{}{"user_data_base64": buildUserData(tt.after)},
+			})), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, buf.String())
+		})
+	}
+}
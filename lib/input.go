@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// DiffUserData func
+// decodes before and after, user data as read from files or instances, and
+// returns the difference between them. Each side is detected independently, see decodeUserData.
+func (d *Diff) DiffUserData(before, after []byte) (*Result, error) {
+	partsA, err := userDataParts(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	partsB, err := userDataParts(after)
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+	return d.result("", partsA, partsB), nil
+}
+
+// instanceAttribute is the output of "aws ec2 describe-instance-attribute --attribute userData".
+type instanceAttribute struct {
+	UserData *struct {
+		Value string `json:"Value"`
+	} `json:"UserData"`
+}
+
+// decodeUserData returns the content of user data b, either a
+// describe-instance-attribute JSON document or encoded content, see
+// detectEncoding, and the encodings detected.
+func decodeUserData(b []byte) ([]byte, EncodingChain) {
+	trimmed := bytes.TrimSpace(b)
+	var attr instanceAttribute
+	if bytes.HasPrefix(trimmed, []byte("{")) && json.Unmarshal(trimmed, &attr) == nil && attr.UserData != nil {
+		b = []byte(attr.UserData.Value)
+	}
+	return detectEncoding(b)
+}
+
+// userDataParts returns the parts of user data b: the parts of a MIME
+// document, or a single part holding the content otherwise, of type
+// text/cloud-config if it starts with "#cloud-config".
+func userDataParts(b []byte) ([]*part, error) {
+	data, chain := decodeUserData(b)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil && msg.Header.Get("Content-Type") != "" {
+		mediaType, _, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIME document: %w", err)
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			_, parts, err := parse(data)
+			return decodeParts(chain, parts), err
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(msg.Body)
+		header := textproto.MIMEHeader(msg.Header)
+		return decodeParts(chain, []*part{{header: header, body: body.Bytes()}}), nil
+	}
+	contentType := "text/plain"
+	switch {
+	case bytes.HasPrefix(data, []byte("#cloud-config")):
+		contentType = "text/cloud-config"
+	case bytes.HasPrefix(data, []byte("#!")):
+		contentType = "text/x-shellscript"
+	}
+	return []*part{{header: textproto.MIMEHeader{"Content-Type": {contentType}}, body: data, encoding: chain}}, nil
+}
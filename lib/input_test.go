@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserDataParts(t *testing.T) {
+	script := "#!/bin/bash\necho hi\n"
+	mimeDoc := "Content-Type: multipart/mixed; boundary=\"B\"\r\n\r\n--B\r\nContent-Type: text/x-shellscript\r\n\r\n" + script + "\r\n--B--\r\n"
+	gzipped, _ := gzipData([]byte(script))
+	gzippedMIME, _ := gzipData([]byte(mimeDoc))
+	tests := []struct {
+		name        string
+		input       string
+		contentType string
+		body        string
+	}{
+		{"plain script", script, "text/x-shellscript", script},
+		{"cloud-config", "#cloud-config\nruncmd: [ls]\n", "text/cloud-config", "#cloud-config\nruncmd: [ls]\n"},
+		{"text", "hello\n", "text/plain", "hello\n"},
+		{"base64", base64Encode([]byte(script)), "text/x-shellscript", script},
+		{"wrapped base64", wrap(base64Encode([]byte(script)), 8), "text/x-shellscript", script},
+		{"gzip", string(gzipped), "text/x-shellscript", script},
+		{"gzip base64", base64Encode(gzipped), "text/x-shellscript", script},
+		{"MIME", mimeDoc, "text/x-shellscript", script},
+		{"gzip MIME base64", base64Encode(gzippedMIME), "text/x-shellscript", script},
+		{"single part MIME", "Content-Type: text/cloud-config\r\n\r\n#cloud-config\n", "text/cloud-config", "#cloud-config\n"},
+		{"describe-instance-attribute", fmt.Sprintf(`{"InstanceId": "i-1", "UserData": {"Value": %q}}`, base64Encode(gzippedMIME)), "text/x-shellscript", script},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := userDataParts([]byte(tt.input))
+			assert.NoError(t, err)
+			if assert.Len(t, parts, 1) {
+				assert.Equal(t, tt.contentType, parts[0].header.Get("Content-Type"))
+				assert.Equal(t, tt.body, strings.ReplaceAll(string(parts[0].body), "\r", ""))
+			}
+		})
+	}
+}
+
+func TestUserDataParts_Empty(t *testing.T) {
+	for _, input := range []string{"", "\n", `{"InstanceId": "i-1", "UserData": {}}`} {
+		parts, err := userDataParts([]byte(input))
+		assert.NoError(t, err)
+		assert.Empty(t, parts)
+	}
+}
+
+func TestDiffUserData(t *testing.T) {
+	gzipped, _ := gzipData([]byte("#!/bin/bash\necho two\n"))
+	running := fmt.Sprintf(`{"UserData": {"Value": %q}}`, base64Encode(gzipped))
+	d, err := NewWithOptions(Options{NoColor: true})
+	assert.NoError(t, err)
+	res, err := d.DiffUserData([]byte(running), []byte("#!/bin/bash\necho 2\n"))
+	assert.NoError(t, err)
+	if assert.Len(t, res.Parts, 1) {
+		assert.Equal(t, "text/x-shellscript", res.Parts[0].Name())
+		inserted, deleted := res.LineCounts()
+		assert.Equal(t, 1, inserted)
+		assert.Equal(t, 1, deleted)
+	}
+}
+
+func wrap(s string, width int) string {
+	lines := make([]string, 0)
+	for len(s) > width {
+		lines = append(lines, s[:width])
+		s = s[width:]
+	}
+	return strings.Join(append(lines, s), "\n")
+}
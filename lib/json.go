@@ -1,25 +1,29 @@
 package diff
 
 import (
-	"fmt"
 	"io"
 	"io/ioutil"
-	"strings"
 
 	tfjson "github.com/hashicorp/terraform-json"
 )
 
 // supported arg for resource type
 var supportedResourceTypeArgs = map[string]string{
-	"aws_instance": "user_data_base64", "aws_launch_template": "user_data", "local_file": "content_base64"}
+	"aws_instance": "user_data_base64", "aws_launch_template": "user_data", "local_file": "content_base64",
+	"azurerm_linux_virtual_machine": "custom_data", "azurerm_windows_virtual_machine": "custom_data",
+	"azurerm_linux_virtual_machine_scale_set": "custom_data", "azurerm_windows_virtual_machine_scale_set": "custom_data",
+	"azurerm_orchestrated_virtual_machine_scale_set": "custom_data",
+	"google_compute_instance":                        "metadata_startup_script", "google_compute_instance_template": "metadata_startup_script"}
 
 // PlanJSON func
 // reads input from r, extracts supported resource change data,
 // decodes the content, then compares and writes diff result to w.
 // List supported args for resource type is declared in supportedResourceTypeArgs.
+// See DiffPlan for what is reported besides the diff, and Check for the errors
+// returned once the result is written.
 //
 // r contains the plan format output by "terraform show -json" command.
-func (d *Diff) PlanJSON(r io.Reader, w io.Writer, noColor bool) error {
+func (d *Diff) PlanJSON(r io.Reader, w io.Writer) error {
 	var planSchema tfjson.Plan
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -29,24 +33,171 @@ func (d *Diff) PlanJSON(r io.Reader, w io.Writer, noColor bool) error {
 	if err != nil {
 		return err
 	}
-	d.Config(noColor)
-	var sb strings.Builder
-	for _, resourceChange := range planSchema.ResourceChanges {
-		arg, ok := supportedResourceTypeArgs[resourceChange.Type]
+	res, err := d.DiffPlan(&planSchema)
+	if err != nil {
+		return err
+	}
+	if err = d.Render(w, res); err != nil {
+		return err
+	}
+	return d.Check(res)
+}
+
+// DiffPlan func
+// compares the before and after values of the user data argument of every
+// changed resource of a supported type in plan.
+// Cloud-config parts are validated against cloud-init's schema, the size of
+// user data is compared with the provider limit (see userDataSizeLimits), and
+// changes are checked against the Policy, if set; a resource whose value is
+// unknown or sensitive gets a warning instead, see Policy.unchecked.
+// The policy is checked on every resource, filters only scope what is shown.
+// User data that can't be read is reported as a decode diagnostic of its
+// resource, the other resources are still compared.
+func (d *Diff) DiffPlan(plan *tfjson.Plan) (*PlanResult, error) {
+	res := &PlanResult{Resources: make([]*ResourceDiff, 0), Violations: make([]Violation, 0)}
+	for _, resourceChange := range plan.ResourceChanges {
+		arg, ok := d.resourceArg(resourceChange.Type)
 		if !ok || resourceChange.Change.Actions.NoOp() {
 			continue
 		}
-		before := getArgValue(resourceChange.Change.Before, arg)
-		after := getArgValue(resourceChange.Change.After, arg)
+		shown := d.opts.Filter.matchResource(resourceChange.Address, resourceChange.Type)
+		change := resourceChange.Change
+		rd := &ResourceDiff{Address: resourceChange.Address, Type: resourceChange.Type, Arg: arg}
+		rd.BeforeState, rd.AfterState = d.argState(change.BeforeSensitive, nil, arg), d.argState(change.AfterSensitive, change.AfterUnknown, arg)
+		before := getArgValue(change.Before, arg)
+		after := getArgValue(change.After, arg)
+		// sensitive values are measured too, the provider limit applies to them
+		rd.SizeBefore, rd.SizeAfter = measureUserData(before), measureUserData(after)
+		rd.SizeLimit = userDataSizeLimits[rd.Type]
+		if rd.Masked() {
+			res.Violations = append(res.Violations, d.opts.Policy.unchecked(rd)...)
+			if shown {
+				res.Resources = append(res.Resources, rd)
+			}
+			continue
+		}
+
+		partsA, errA := toParts(before)
+		partsB, errB := toParts(after)
+		if errA != nil || errB != nil {
+			rd.Result = &Result{Diagnostics: userDataDiagnostics(rd, errA, errB)}
+			if shown {
+				res.Resources = append(res.Resources, rd)
+			}
+			continue
+		}
+		// the policy is checked on every change, filters only scope what is shown
+		parts := d.compareParts(rd.Address, partsA, partsB)
+		res.Violations = append(res.Violations, d.opts.Policy.check(rd.Address, parts)...)
+		rd.Result = &Result{Parts: d.filterPartDiffs(parts), Diagnostics: d.checkDecoding(rd.Address, partsA, partsB)}
+		if !d.opts.NoValidate {
+			rd.SchemaErrors = append(validateParts("before", partsA), validateParts("after", partsB)...)
+		}
+		if shown && !rd.empty() {
+			res.Resources = append(res.Resources, rd)
+		}
+	}
+	return res, nil
+}
+
+// userDataDiagnostics returns the diagnostics of the user data of rd that can't
+// be read, errBefore and errAfter are the errors of each side, if any.
+func userDataDiagnostics(rd *ResourceDiff, errBefore, errAfter error) []DecodeDiagnostic {
+	diagnostics := make([]DecodeDiagnostic, 0, 2)
+	for _, side := range []struct {
+		name string
+		err  error
+	}{{"before", errBefore}, {"after", errAfter}} {
+		if side.err != nil {
+			diagnostics = append(diagnostics, DecodeDiagnostic{rd.Address, side.name, rd.Arg, "", side.err.Error(), SeverityError})
+		}
+	}
+	return diagnostics
+}
+
+// resourceArg returns the user data argument of resources of type typ, from
+// Options.ResourceArgs or supportedResourceTypeArgs.
+func (d *Diff) resourceArg(typ string) (string, bool) {
+	if arg, ok := d.opts.ResourceArgs[typ]; ok {
+		return arg, true
+	}
+	arg, ok := supportedResourceTypeArgs[typ]
+	return arg, ok
+}
+
+// Render func
+// writes res to w in the format set in Options.
+func (d *Diff) Render(w io.Writer, res *PlanResult) error {
+	r, err := newRenderer(d.opts)
+	if err != nil {
+		return err
+	}
+	return r.RenderPlan(w, res)
+}
+
+// Check func
+// returns a *PolicyError if res has policy violations of severity error,
+// a *SizeLimitError if FailOnSizeLimit is set and user data is over the provider limit,
+// or a *DecodeError if Strict is set and content doesn't decode as declared.
+func (d *Diff) Check(res *PlanResult) error {
+	if err := policyError(res.Violations); err != nil {
+		return err
+	}
+	overLimit := make([]string, 0)
+	diagnostics := make([]DecodeDiagnostic, 0)
+	for _, rd := range res.Resources {
+		if rd.OverSizeLimit() {
+			overLimit = append(overLimit, rd.Address)
+		}
+		if rd.Result != nil {
+			diagnostics = append(diagnostics, rd.Result.Diagnostics...)
+		}
+	}
+	if d.opts.FailOnSizeLimit && len(overLimit) > 0 {
+		return &SizeLimitError{overLimit}
+	}
+	return d.decodeError(diagnostics)
+}
 
-		if diffStr := d.diffParts(toParts(before), toParts(after)); diffStr != "" {
-			sb.WriteString(d.color.Color(fmt.Sprintf("[cyan]@@ %s[reset]\n", resourceChange.Address)))
-			sb.WriteString(diffStr)
-			sb.WriteString("\n")
+// policyError returns a PolicyError holding the violations of severity error, if any.
+func policyError(violations []Violation) error {
+	errs := make([]Violation, 0)
+	for _, v := range violations {
+		if v.Rule.Severity == SeverityError {
+			errs = append(errs, v)
 		}
 	}
-	w.Write([]byte(strings.TrimRight(sb.String(), "\n")))
-	return nil
+	if len(errs) == 0 {
+		return nil
+	}
+	return &PolicyError{errs}
+}
+
+// argState returns how the value of arg is rendered when it can't be decoded:
+// "(known after apply)" if unknown, "(sensitive value)" if sensitive and not shown.
+// It returns "" if the value can be decoded.
+func (d *Diff) argState(sensitive, unknown interface{}, arg string) string {
+	if isMarked(unknown, arg) {
+		return "(known after apply)"
+	}
+	if !d.opts.ShowSensitive && isMarked(sensitive, arg) {
+		return "(sensitive value)"
+	}
+	return ""
+}
+
+// isMarked reports whether arg is marked in mask, one of the
+// after_unknown/before_sensitive/after_sensitive values of a plan change:
+// either a bool applying to the whole object, or an object of per-attribute marks.
+func isMarked(mask interface{}, arg string) bool {
+	switch m := mask.(type) {
+	case bool:
+		return m
+	case map[string]interface{}:
+		marked, _ := m[arg].(bool)
+		return marked
+	}
+	return false
 }
 func getArgValue(obj interface{}, name string) string {
 	if obj == nil || obj.(map[string]interface{})[name] == nil {
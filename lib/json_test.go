@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanJSON_SensitiveAndUnknown(t *testing.T) {
+	before, after := buildUserData("echo one"), buildUserData("echo two")
+	tests := []struct {
+		name          string
+		change        map[string]interface{}
+		showSensitive bool
+		expect        string
+	}{
+		{"known after apply", map[string]interface{}{
+			"before": map[string]interface{}{"user_data_base64": before}, "after": map[string]interface{}{},
+			"after_unknown": map[string]interface{}{"user_data_base64": true},
+		}, false, "@@ aws_instance.this\n~  user_data_base64: (decoded value) -> (known after apply)"},
+		{"sensitive", map[string]interface{}{
+			"before": map[string]interface{}{"user_data_base64": before}, "after": map[string]interface{}{"user_data_base64": after},
+			"before_sensitive": map[string]interface{}{"user_data_base64": true}, "after_sensitive": true,
+		}, false, "@@ aws_instance.this\n~  user_data_base64: (sensitive value) -> (sensitive value)"},
+		{"show sensitive", map[string]interface{}{
+			"before": map[string]interface{}{"user_data_base64": before}, "after": map[string]interface{}{"user_data_base64": after},
+			"after_sensitive": true,
+		}, true, "@@ aws_instance.this\n   size: payload 171 B -> 173 B (+2 B)\nContent-Type: text/x-shellscript  # encoding: base64+gzip\n    1|      -  echo one\n     |1     +  echo two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := NewWithOptions(Options{NoColor: true, ShowSensitive: tt.showSensitive})
+			var buf bytes.Buffer
+			err := d.PlanJSON(strings.NewReader(buildPlan(t, tt.change)), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, buf.String())
+		})
+	}
+}
+
+func buildPlan(t *testing.T, change map[string]interface{}) string {
+	t.Helper()
+	change["actions"] = []string{"update"}
+	plan := map[string]interface{}{
+		"format_version": "1.1",
+		"resource_changes": []interface{}{map[string]interface{}{
+			"address": "aws_instance.this", "mode": "managed", "type": "aws_instance", "name": "this",
+			"change": change,
+		}},
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// buildUserData returns a gzipped and base64 encoded multipart document with one shell script part.
+func buildUserData(script string) string {
+	doc := fmt.Sprintf(`Content-Type: multipart/mixed; boundary="MIMEBOUNDARY"
+MIME-Version: 1.0
+
+--MIMEBOUNDARY
+Content-Transfer-Encoding: 7bit
+Content-Type: text/x-shellscript
+Mime-Version: 1.0
+
+%s
+--MIMEBOUNDARY--
+`, script)
+	b, _ := gzipData([]byte(strings.ReplaceAll(doc, "\n", "\r\n")))
+	return base64Encode(b)
+}
+
+func TestPlanJSON_ResourceArgs(t *testing.T) {
+	plan := strings.NewReplacer(`"aws_instance`, `"my_vm`).Replace(buildPlan(t, map[string]interface{}{
+		"before": map[string]interface{}{"boot_script": buildUserData("echo one")},
+		"after":  map[string]interface{}{"boot_script": buildUserData("echo two")},
+	}))
+	d, _ := NewWithOptions(Options{NoColor: true, ResourceArgs: map[string]string{"my_vm": "boot_script"}})
+	var buf bytes.Buffer
+	assert.NoError(t, d.PlanJSON(strings.NewReader(plan), &buf))
+	assert.Equal(t, "@@ my_vm.this\n   size: payload 171 B -> 173 B (+2 B)\nContent-Type: text/x-shellscript  # encoding: base64+gzip\n    1|      -  echo one\n     |1     +  echo two", buf.String())
+}
+
+func TestDiffPlan_UnreadableUserData(t *testing.T) {
+	invalid := base64Encode([]byte("Content-Type: multipart/mixed; boundary\r\n\r\nx"))
+	plan := map[string]interface{}{
+		"format_version": "1.1",
+		"resource_changes": []interface{}{
+			map[string]interface{}{"address": "aws_instance.bad", "mode": "managed", "type": "aws_instance", "name": "bad",
+				"change": map[string]interface{}{"actions": []string{"update"},
+					"before": map[string]interface{}{"user_data_base64": buildUserData("echo one")},
+					"after":  map[string]interface{}{"user_data_base64": invalid}}},
+			map[string]interface{}{"address": "aws_instance.good", "mode": "managed", "type": "aws_instance", "name": "good",
+				"change": map[string]interface{}{"actions": []string{"update"},
+					"before": map[string]interface{}{"user_data_base64": buildUserData("echo one")},
+					"after":  map[string]interface{}{"user_data_base64": buildUserData("echo two")}}},
+		},
+	}
+	b, _ := json.Marshal(plan)
+	d, _ := NewWithOptions(Options{NoColor: true, Strict: true})
+	var buf bytes.Buffer
+	err := d.PlanJSON(bytes.NewReader(b), &buf)
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.EqualError(t, err, "content doesn't decode as declared: aws_instance.bad (after)")
+	assert.Contains(t, buf.String(), "! decode (after) user_data_base64 invalid MIME document: mime: invalid media parameter")
+	assert.Contains(t, buf.String(), "@@ aws_instance.good")
+}
+
+func TestPlanJSON_PlainUserData(t *testing.T) {
+	plan := buildPlan(t, map[string]interface{}{
+		"before": map[string]interface{}{"user_data_base64": base64Encode([]byte("#cloud-config\nruncmd:\n- echo one\n"))},
+		"after":  map[string]interface{}{"user_data_base64": base64Encode([]byte("#cloud-config\nruncmd:\n- echo two\n"))},
+	})
+	d, _ := NewWithOptions(Options{NoColor: true})
+	var buf bytes.Buffer
+	assert.NoError(t, d.PlanJSON(strings.NewReader(plan), &buf))
+	assert.Contains(t, buf.String(), "Content-Type: text/cloud-config  # encoding: base64")
+	assert.Contains(t, buf.String(), "echo two")
+}
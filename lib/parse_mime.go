@@ -2,8 +2,8 @@ package diff
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"log"
 	"mime"
 	"mime/multipart"
 	"net/mail"
@@ -14,16 +14,21 @@ import (
 type part struct {
 	header textproto.MIMEHeader
 	body   []byte
+	// encoding is the chain of encodings decoded to get body, from the user data down to the part.
+	encoding EncodingChain
 }
 
 func (p part) isYAML() bool {
 	return p.header.Get("Content-Type") == "text/cloud-config"
 }
-func parse(b []byte) (map[string]string, []*part) {
-	msg, _ := mail.ReadMessage(bytes.NewBuffer(b))
+func parse(b []byte) (map[string]string, []*part, error) {
+	msg, err := mail.ReadMessage(bytes.NewBuffer(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid MIME document: %w", err)
+	}
 	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, fmt.Errorf("invalid MIME document: %w", err)
 	}
 	parts := make([]*part, 0)
 	if strings.HasPrefix(mediaType, "multipart/") {
@@ -31,19 +36,35 @@ func parse(b []byte) (map[string]string, []*part) {
 		for {
 			p, err := mr.NextPart()
 			if err == io.EOF {
-				return params, parts
+				return params, parts, nil
 			}
 			if err != nil {
-				log.Fatal(err)
+				return nil, nil, fmt.Errorf("invalid MIME part %d: %w", len(parts)+1, err)
 			}
 			slurp, err := io.ReadAll(p)
 			if err != nil {
-				log.Fatal(err)
+				return nil, nil, fmt.Errorf("invalid MIME part %d: %w", len(parts)+1, err)
+			}
+			parts = append(parts, &part{header: p.Header, body: slurp})
+		}
+	}
+	return nil, nil, nil
+}
+
+// decodeParts decodes the body of parts, whose document was decoded by
+// chain: the Content-Transfer-Encoding, if base64, then the detected encodings.
+func decodeParts(chain EncodingChain, parts []*part) []*part {
+	for _, p := range parts {
+		p.encoding = append(EncodingChain{}, chain...)
+		if strings.EqualFold(p.header.Get("Content-Transfer-Encoding"), "base64") {
+			if body, err := base64Decode(string(removeSpaces(p.body))); err == nil {
+				p.body = body
+				p.encoding = append(p.encoding, "base64")
 			}
-			// fmt.Println(p.Header)
-			parts = append(parts, &part{p.Header, slurp})
-			// fmt.Printf("Part %q: %q\n", p.Header.Get("Content-Type"), slurp)
 		}
+		body, bodyChain := detectEncoding(p.body)
+		p.body = body
+		p.encoding = append(p.encoding, bodyChain...)
 	}
-	return nil, nil
+	return parts
 }
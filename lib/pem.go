@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultCertExpiryDays is the number of days before expiry a certificate is reported as expiring.
+const defaultCertExpiryDays = 30
+
+// now returns the current time, certificates are checked for expiry against it.
+var now = time.Now
+
+// pemLines returns s with PEM blocks replaced by a description of their
+// content, so changes to certificates and keys are compared by meaning rather
+// than by lines of base64. Private keys are described by their fingerprint only,
+// even when they don't decode, see invalidPrivateKey.
+func (d *Diff) pemLines(s string) string {
+	const begin, end = "-----BEGIN ", "-----END "
+	if !strings.Contains(s, begin) {
+		return s
+	}
+	sb := strings.Builder{}
+	rest := s
+	for {
+		i := strings.Index(rest, begin)
+		j := strings.Index(rest[i+1:], end)
+		if i < 0 {
+			sb.WriteString(rest)
+			return sb.String()
+		}
+		if j < 0 {
+			// a block without END runs to the end of s
+			if desc, ok := invalidPrivateKey(rest[i:]); ok {
+				rest = rest[:i] + desc
+			}
+			sb.WriteString(rest)
+			return sb.String()
+		}
+		// the block runs to the end of the line of its END marker
+		blockEnd := len(rest)
+		if k := strings.Index(rest[i+1+j:], "\n"); k >= 0 {
+			blockEnd = i + 1 + j + k + 1
+		}
+		sb.WriteString(rest[:i])
+		if block, _ := pem.Decode([]byte(rest[i:blockEnd])); block != nil {
+			sb.WriteString(strings.Join(d.describePEMBlock(block), "\n") + "\n")
+		} else if desc, ok := invalidPrivateKey(rest[i:blockEnd]); ok {
+			sb.WriteString(desc + "\n")
+		} else {
+			// not a valid block, keep it as is
+			sb.WriteString(rest[i:blockEnd])
+		}
+		rest = rest[blockEnd:]
+	}
+}
+
+// invalidPrivateKey returns the SHA-256 of text, a PEM block that doesn't
+// decode, if its BEGIN line is of a private key: the key must not be shown,
+// even broken.
+func invalidPrivateKey(text string) (string, bool) {
+	firstLine := strings.SplitN(text, "\n", 2)[0]
+	if !strings.Contains(firstLine, "PRIVATE KEY") {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(text))
+	return "private key: invalid PEM, SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), true
+}
+
+// describePEMBlock returns the lines describing block: the fields of a
+// certificate, the algorithm and fingerprint of a key, or the SHA-256 of the
+// block for other types.
+func (d *Diff) describePEMBlock(block *pem.Block) []string {
+	switch {
+	case block.Type == "CERTIFICATE":
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			return d.describeCertificate(cert)
+		}
+	case block.Type == "PUBLIC KEY":
+		if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+			return []string{"public key: " + describePublicKey(key)}
+		}
+	case block.Type == "RSA PUBLIC KEY":
+		if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			return []string{"public key: " + describePublicKey(key)}
+		}
+	case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+		if key := parsePrivateKey(block); key != nil {
+			return []string{"private key: " + describePublicKey(key.Public())}
+		}
+		// e.g. encrypted or OPENSSH keys, the fingerprint of the block tells whether it changed
+		sum := sha256.Sum256(block.Bytes)
+		return []string{fmt.Sprintf("private key: %s, block SHA256:%s", strings.ToLower(block.Type), base64.RawStdEncoding.EncodeToString(sum[:]))}
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return []string{fmt.Sprintf("%s: sha256 %s", strings.ToLower(block.Type), hex.EncodeToString(sum[:]))}
+}
+
+// describeCertificate returns the subject, issuer, SANs, serial, validity and
+// public key of cert, and whether it is expired or expiring.
+func (d *Diff) describeCertificate(cert *x509.Certificate) []string {
+	lines := []string{
+		"certificate:",
+		"  subject: " + cert.Subject.String(),
+		"  issuer: " + cert.Issuer.String(),
+	}
+	sans := make([]string, 0)
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	if len(sans) > 0 {
+		lines = append(lines, "  SANs: "+strings.Join(sans, ", "))
+	}
+	lines = append(lines,
+		"  serial: "+formatSerial(cert.SerialNumber.Bytes()),
+		"  not before: "+cert.NotBefore.UTC().Format(time.RFC3339),
+		"  not after: "+cert.NotAfter.UTC().Format(time.RFC3339),
+		"  status: "+d.certStatus(cert),
+		"  public key: "+describePublicKey(cert.PublicKey),
+	)
+	return lines
+}
+
+// certStatus returns whether cert is valid, not yet valid, expired, or expiring within Options.CertExpiryDays.
+func (d *Diff) certStatus(cert *x509.Certificate) string {
+	expiryDays := d.opts.CertExpiryDays
+	if expiryDays == 0 {
+		expiryDays = defaultCertExpiryDays
+	}
+	t := now()
+	switch {
+	case t.After(cert.NotAfter):
+		return "expired"
+	case t.Before(cert.NotBefore):
+		return "not yet valid"
+	}
+	days := int(math.Ceil(cert.NotAfter.Sub(t).Hours() / 24))
+	if days <= expiryDays {
+		return fmt.Sprintf("expiring in %s", plural(days, "day"))
+	}
+	return "valid"
+}
+
+// formatSerial returns a serial number as colon separated hex bytes, like openssl.
+func formatSerial(b []byte) string {
+	if len(b) == 0 {
+		return "00"
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// describePublicKey returns the algorithm, size and SHA-256 fingerprint of key.
+func describePublicKey(key crypto.PublicKey) string {
+	algorithm := "unknown"
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		algorithm = fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		algorithm = "Ed25519"
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return algorithm
+	}
+	sum := sha256.Sum256(der)
+	return fmt.Sprintf("%s, SHA256:%s", algorithm, base64.RawStdEncoding.EncodeToString(sum[:]))
+}
+
+// privateKey is implemented by the private keys of crypto/x509.
+type privateKey interface {
+	Public() crypto.PublicKey
+}
+
+// parsePrivateKey returns the private key of block, nil if it can't be parsed.
+func parsePrivateKey(block *pem.Block) privateKey {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key
+		}
+	case "EC PRIVATE KEY":
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return key
+		}
+	case "PRIVATE KEY":
+		if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			if k, ok := key.(privateKey); ok {
+				return k
+			}
+		}
+	}
+	return nil
+}
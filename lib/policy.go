@@ -0,0 +1,274 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a policy rule
+type Severity string
+
+const (
+	// SeverityInfo reports a change without failing the run.
+	SeverityInfo Severity = "info"
+	// SeverityWarning reports a change without failing the run.
+	SeverityWarning Severity = "warning"
+	// SeverityError reports a change and fails the run.
+	SeverityError Severity = "error"
+)
+
+// Rule flags a risky change in decoded user data.
+// Every field that is set must match; Resource, ContentType, Path and Key are
+// globs in path.Match syntax, Line is a regular expression.
+type Rule struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Severity    Severity `yaml:"severity"`
+	// Resource matches the resource address, e.g. module.web.aws_instance.*
+	Resource string `yaml:"resource"`
+	// ContentType matches the Content-Type of the MIME part, e.g. text/x-shellscript
+	ContentType string `yaml:"content_type"`
+	// Path matches the write_files path, e.g. /etc/sudoers.d/*
+	Path string `yaml:"path"`
+	// Key matches the write_files key, e.g. permissions or owner
+	Key string `yaml:"key"`
+	// Line matches a changed line
+	Line string `yaml:"line"`
+	// On selects the lines Line is matched against: added (default), removed or any.
+	On string `yaml:"on"`
+
+	line *regexp.Regexp
+}
+
+// Policy is a list of rules, see LoadPolicy.
+type Policy struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Violation is a change matched by a rule.
+type Violation struct {
+	Rule        *Rule
+	Address     string
+	ContentType string
+	Path        string
+	Key         string
+	// Line is the changed line matched by Rule.Line, if set.
+	Line string
+}
+
+// location returns the resource address, followed by the file path (or the
+// part Content-Type) and the key of the violation.
+func (v Violation) location() string {
+	where := v.Path
+	if where == "" {
+		where = v.ContentType
+	}
+	return strings.Join(strings.Fields(strings.Join([]string{v.Address, where, v.Key}, " ")), " ")
+}
+
+// message returns the rule description, or "matched" if it has none.
+func (v Violation) message() string {
+	if v.Rule.Description == "" {
+		return "matched"
+	}
+	return v.Rule.Description
+}
+
+// PolicyError is returned when changes violate rules of severity error.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%d policy violation(s) of severity error", len(e.Violations))
+}
+
+// LoadPolicy func
+// reads rules from a YAML document like:
+//
+//	rules:
+//	- name: sudoers
+//	  description: any change to /etc/sudoers.d/*
+//	  severity: error
+//	  path: /etc/sudoers.d/*
+//	- name: curl-pipe-shell
+//	  severity: warning
+//	  line: curl .*\|\s*(ba)?sh
+func LoadPolicy(r io.Reader) (*Policy, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err = yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	for i, rule := range p.Rules {
+		if err = rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid policy rule %d (%s): %w", i+1, rule.Name, err)
+		}
+	}
+	return &p, nil
+}
+func (rule *Rule) compile() error {
+	switch rule.Severity {
+	case "":
+		rule.Severity = SeverityError
+	case SeverityInfo, SeverityWarning, SeverityError:
+	default:
+		return fmt.Errorf("unknown severity %q", rule.Severity)
+	}
+	switch rule.On {
+	case "", "added", "removed", "any":
+	default:
+		return fmt.Errorf("unknown value %q for on, expected added, removed or any", rule.On)
+	}
+	for _, glob := range []string{rule.Resource, rule.ContentType, rule.Path, rule.Key} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	if rule.Line != "" {
+		re, err := regexp.Compile(rule.Line)
+		if err != nil {
+			return err
+		}
+		rule.line = re
+	}
+	return nil
+}
+
+// lineChange is the unit rules are matched against: the changed lines of a
+// write_files, users or groups key, of a cloud-config key, or of a whole MIME part.
+type lineChange struct {
+	contentType, path, key string
+	added, removed         []string
+}
+
+func toLineChanges(pd *PartDiff) []lineChange {
+	contentType := pd.ContentType()
+	if pd.Objects == nil {
+		added, removed := chunkLines(pd.Chunks)
+		return []lineChange{{contentType: contentType, added: added, removed: removed}}
+	}
+	changes := make([]lineChange, 0)
+	for _, obj := range pd.Objects {
+		path := ""
+		if obj.isFile() {
+			path = obj.Path
+		}
+		if len(obj.Fields) == 0 {
+			// a path added or removed without any other key
+			changes = append(changes, lineChange{contentType: contentType, path: path})
+		}
+		merged := make(map[string]int)
+		for _, field := range obj.Fields {
+			added, removed := chunkLines(field.Chunks)
+			key := field.Key
+			switch {
+			case obj.Path == "":
+				// the commands of a list are changes of its key, e.g. runcmd
+				key = listKey(key)
+			case obj.isFile() && isDirectiveKey(key):
+				// the directives of a unit file are changes of its content,
+				// matched as lines like "[Service] ExecStart=/usr/bin/app"
+				added, removed = directiveLines(key, added), directiveLines(key, removed)
+				key = "content"
+			}
+			if i, ok := merged[key]; ok {
+				changes[i].added, changes[i].removed = append(changes[i].added, added...), append(changes[i].removed, removed...)
+				continue
+			}
+			merged[key] = len(changes)
+			changes = append(changes, lineChange{contentType, path, key, added, removed})
+		}
+	}
+	return changes
+}
+func directiveLines(key string, values []string) []string {
+	lines := make([]string, len(values))
+	for i, value := range values {
+		lines[i] = key + "=" + value
+	}
+	return lines
+}
+func chunkLines(chunks []Chunk) (added, removed []string) {
+	for _, c := range chunks {
+		added = append(added, c.Added...)
+		removed = append(removed, c.Deleted...)
+	}
+	return added, removed
+}
+
+// check returns the violations of the changes of a resource, one per rule and changed key at most.
+func (p *Policy) check(address string, diffs []*PartDiff) []Violation {
+	if p == nil {
+		return nil
+	}
+	violations := make([]Violation, 0)
+	for _, pd := range diffs {
+		for _, c := range toLineChanges(pd) {
+			for _, rule := range p.Rules {
+				if line, ok := rule.match(address, c); ok {
+					violations = append(violations, Violation{rule, address, c.contentType, c.path, c.key, line})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// unchecked returns a warning for resource rd, whose value is unknown or
+// sensitive and can't be checked, if any rule applies to its address: a
+// violation could be hidden in it.
+func (p *Policy) unchecked(rd *ResourceDiff) []Violation {
+	if p == nil {
+		return nil
+	}
+	for _, rule := range p.Rules {
+		if globMatch(rule.Resource, rd.Address) {
+			before, after := rd.states()
+			unchecked := &Rule{Name: "unchecked", Severity: SeverityWarning,
+				Description: fmt.Sprintf("%s -> %s, changes can't be checked against the policy", before, after)}
+			return []Violation{{Rule: unchecked, Address: rd.Address, Key: rd.Arg}}
+		}
+	}
+	return nil
+}
+func (rule *Rule) match(address string, c lineChange) (string, bool) {
+	if !globMatch(rule.Resource, address) || !globMatch(rule.ContentType, c.contentType) ||
+		!globMatch(rule.Path, c.path) || !globMatch(rule.Key, c.key) {
+		return "", false
+	}
+	if rule.line == nil {
+		return "", true
+	}
+	lines := c.added
+	switch rule.On {
+	case "removed":
+		lines = c.removed
+	case "any":
+		lines = append(append([]string{}, c.added...), c.removed...)
+	}
+	for _, line := range lines {
+		if rule.line.MatchString(line) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// globMatch reports whether s matches pattern, an empty pattern matches anything.
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
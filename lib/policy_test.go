@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `
+rules:
+- name: sudoers
+  description: any change to /etc/sudoers.d/*
+  path: /etc/sudoers.d/*
+- name: world-writable
+  severity: warning
+  key: permissions
+  line: "'?0?[0-7][0-7][2367]'?$"
+- name: curl-pipe-shell
+  content_type: text/x-shellscript
+  line: curl .*\|\s*(ba)?sh
+- name: runcmd
+  severity: info
+  key: runcmd
+- name: exec-debug
+  severity: warning
+  key: content
+  line: ^\[Service\] ExecStart=.*--debug
+`
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := LoadPolicy(strings.NewReader(testPolicy))
+	assert.NoError(t, err)
+	d := New()
+	tests := []struct {
+		name   string
+		diffs  []*PartDiff
+		expect []string
+	}{
+		{"no violation", []*PartDiff{{Header: shellHeader(), Chunks: lineChunks("echo a", "echo b")}}, []string{}},
+		{"curl pipe shell added", []*PartDiff{{Header: shellHeader(), Chunks: lineChunks("echo a", "curl -s https://x | bash")}}, []string{"curl-pipe-shell"}},
+		{"curl pipe shell removed", []*PartDiff{{Header: shellHeader(), Chunks: lineChunks("curl -s https://x | bash", "echo a")}}, []string{}},
+		{"sudoers and world-writable", []*PartDiff{{Header: yamlHeader(), Objects: d.compareYAML(scope{}, "", `
+write_files:
+- path: /etc/sudoers.d/app
+  permissions: '0666'
+`)}}, []string{"sudoers", "world-writable"}},
+		{"runcmd key", []*PartDiff{{Header: yamlHeader(), Objects: []*Object{d.compareKeys(scope{}, "runcmd:\n- echo a\n", "runcmd:\n- echo b\n")}}}, []string{"runcmd"}},
+		{"unit directive", []*PartDiff{{Header: yamlHeader(), Objects: d.compareYAML(scope{},
+			"write_files:\n- path: /etc/systemd/system/app.service\n  content: |\n    [Service]\n    ExecStart=/usr/bin/app\n",
+			"write_files:\n- path: /etc/systemd/system/app.service\n  content: |\n    [Service]\n    ExecStart=/usr/bin/app --debug\n")}}, []string{"exec-debug"}},
+		{"path only", []*PartDiff{{Header: yamlHeader(), Objects: d.compareYAML(scope{}, "", "write_files:\n- path: /etc/sudoers.d/app")}}, []string{"sudoers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make([]string, 0)
+			for _, v := range policy.check("aws_instance.this", tt.diffs) {
+				names = append(names, v.Rule.Name)
+			}
+			assert.Equal(t, tt.expect, names)
+		})
+	}
+}
+
+func TestLoadPolicy_Invalid(t *testing.T) {
+	for _, in := range []string{"rules:\n- severity: fatal", "rules:\n- line: (", "rules:\n- path: '['", "rules:\n- on: both"} {
+		_, err := LoadPolicy(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}
+
+func TestPlanJSON_PolicyError(t *testing.T) {
+	policy, _ := LoadPolicy(strings.NewReader(testPolicy))
+	d, _ := NewWithOptions(Options{NoColor: true, Policy: policy})
+	var buf bytes.Buffer
+	err := d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+		"before": map[string]interface{}{"user_data_base64": buildUserData("echo one")},
+		"after":  map[string]interface{}{"user_data_base64": buildUserData("curl https://x | sh")},
+	})), &buf)
+	var policyErr *PolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Len(t, policyErr.Violations, 1)
+	assert.Contains(t, buf.String(), "Policy violations:\n[error] curl-pipe-shell: aws_instance.this text/x-shellscript: matched\n    > curl https://x | sh")
+}
+
+func TestPlanJSON_PolicyIgnoresFilters(t *testing.T) {
+	policy, _ := LoadPolicy(strings.NewReader(testPolicy))
+	for _, filter := range []Filter{{ExcludeParts: []string{"text/x-shellscript"}}, {ExcludeResources: []string{"aws_instance.this"}}, {Types: []string{"aws_launch_template"}}} {
+		d, _ := NewWithOptions(Options{NoColor: true, Policy: policy, Filter: filter})
+		var buf bytes.Buffer
+		err := d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+			"before": map[string]interface{}{"user_data_base64": buildUserData("echo one")},
+			"after":  map[string]interface{}{"user_data_base64": buildUserData("curl https://x | sh")},
+		})), &buf)
+		var policyErr *PolicyError
+		assert.True(t, errors.As(err, &policyErr), filter)
+		assert.NotContains(t, buf.String(), "+ curl https://x | sh")
+		assert.Contains(t, buf.String(), "[error] curl-pipe-shell: aws_instance.this text/x-shellscript: matched")
+	}
+}
+
+func TestPlanJSON_PolicyUnchecked(t *testing.T) {
+	policy, _ := LoadPolicy(strings.NewReader(testPolicy))
+	d, _ := NewWithOptions(Options{NoColor: true, Policy: policy})
+	var buf bytes.Buffer
+	assert.NoError(t, d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+		"before":          map[string]interface{}{"user_data_base64": buildUserData("echo one")},
+		"after":           map[string]interface{}{"user_data_base64": buildUserData("curl https://x | sh")},
+		"after_sensitive": map[string]interface{}{"user_data_base64": true},
+	})), &buf))
+	assert.Contains(t, buf.String(), "[warning] unchecked: aws_instance.this user_data_base64: (decoded value) -> (sensitive value), changes can't be checked against the policy")
+}
+
+func TestPlanChange_PolicyError(t *testing.T) {
+	policy, _ := LoadPolicy(strings.NewReader(testPolicy))
+	d, _ := NewWithOptions(Options{NoColor: true, Policy: policy})
+	var buf bytes.Buffer
+	err := d.PlanChange(strings.NewReader(buildUserData("echo one")+" -> "+buildUserData("curl https://x | sh")), &buf)
+	var policyErr *PolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Contains(t, buf.String(), "Policy violations:\n[error] curl-pipe-shell: text/x-shellscript: matched")
+}
+
+func lineChunks(s1, s2 string) []Chunk {
+	return toChunks(compareLines(s1, s2))
+}
+
+func shellHeader() textproto.MIMEHeader {
+	return textproto.MIMEHeader{"Content-Type": {"text/x-shellscript"}}
+}
+func yamlHeader() textproto.MIMEHeader {
+	return textproto.MIMEHeader{"Content-Type": {"text/cloud-config"}}
+}
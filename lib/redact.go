@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// defaultRedactPatterns are the built-in secret detectors.
+// If a pattern has a capturing group, only the first group is redacted, otherwise the whole match.
+var defaultRedactPatterns = []string{
+	// PEM private keys, including RSA/EC/OPENSSH/ENCRYPTED variants
+	`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`,
+	// AWS access key IDs
+	`\b(?:AKIA|ASIA|AIDA|AROA)[0-9A-Z]{16}\b`,
+	// password=..., token: ..., secret = "..."
+	`(?i)(?:password|passwd|pwd|token|secret|api_?key)["']?[ \t]*[=:][ \t]*("[^"\n]*"|'[^'\n]*'|[^\s"',;]+)`,
+}
+
+// DefaultRedactKey is the key of the hash of redaction markers when none is
+// set. It is public: markers keyed with it are stable across runs and
+// machines, but a short secret could be guessed from its marker by hashing
+// candidates. Set a private key, e.g. from a CI secret, to prevent that.
+const DefaultRedactKey = "diffdecoding"
+
+// Redactor replaces secrets found in decoded content by a marker holding a
+// short keyed hash of the secret, so a changed secret still shows as a changed
+// line and reviewers can tell whether two secrets differ, without seeing them.
+// Markers are stable: the same secret and key always give the same marker.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	key      []byte
+}
+
+// NewRedactor func
+// returns a Redactor using the built-in detectors plus the given regular
+// expressions, keyed with DefaultRedactKey.
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	return NewRedactorWithKey(DefaultRedactKey, patterns...)
+}
+
+// NewRedactorWithKey func
+// returns a Redactor like NewRedactor, whose markers are keyed with key.
+func NewRedactorWithKey(key string, patterns ...string) (*Redactor, error) {
+	r := &Redactor{key: []byte(key)}
+	for _, p := range append(append([]string{}, defaultRedactPatterns...), patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact returns s with every detected secret replaced. Secrets detected by
+// several patterns, or overlapping, are replaced once, as a whole.
+// A nil Redactor returns s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	spans := make([][2]int, 0)
+	for _, re := range r.patterns {
+		spans = append(spans, matchSpans(re, s)...)
+	}
+	if len(spans) == 0 {
+		return s
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var out []byte
+	last := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i][0], spans[i][1]
+		for i++; i < len(spans) && spans[i][0] < end; i++ {
+			if spans[i][1] > end {
+				end = spans[i][1]
+			}
+		}
+		out = append(out, s[last:start]...)
+		out = append(out, r.marker(s[start:end])...)
+		last = end
+	}
+	return string(append(out, s[last:]...))
+}
+
+// matchSpans returns the offsets of the matches of re in s: of the first
+// group if re has one, otherwise of the whole match.
+func matchSpans(re *regexp.Regexp, s string) [][2]int {
+	spans := make([][2]int, 0)
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+	return spans
+}
+
+// marker returns the replacement for secret, the first 12 hex digits of its HMAC-SHA256 by the key of r.
+func (r *Redactor) marker(secret string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(secret))
+	return fmt.Sprintf("[REDACTED hmac:%s]", hex.EncodeToString(mac.Sum(nil))[:12])
+}
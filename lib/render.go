@@ -0,0 +1,183 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Renderer writes a diff result in an output format.
+type Renderer interface {
+	// RenderResult writes the difference between two user data blobs, see Diff.DiffBlobs.
+	RenderResult(w io.Writer, res *Result) error
+	// RenderPlan writes the difference of every resource of a plan, see Diff.DiffPlan.
+	RenderPlan(w io.Writer, res *PlanResult) error
+}
+
+// renderers holds the constructors of the output formats, by name.
+var renderers = map[string]func(opts Options) Renderer{
+	"text": func(opts Options) Renderer { return NewTextRenderer(opts) },
+	"no-color": func(opts Options) Renderer {
+		opts.NoColor = true
+		return NewTextRenderer(opts)
+	},
+	"markdown":           func(opts Options) Renderer { return NewMarkdownRenderer(opts) },
+	"html":               func(opts Options) Renderer { return NewHTMLRenderer(opts) },
+	"github-annotations": func(opts Options) Renderer { return NewGitHubAnnotationsRenderer(opts) },
+	"gitlab-codequality": func(opts Options) Renderer { return NewGitLabCodeQualityRenderer(opts) },
+	"stat":               func(opts Options) Renderer { return NewStatRenderer(opts, false) },
+	"summary":            func(opts Options) Renderer { return NewStatRenderer(opts, true) },
+}
+
+// RegisterFormat func
+// makes the Renderer returned by fn available as Options.Format name, replacing
+// any format with the same name. It is not safe to call concurrently with NewWithOptions.
+func RegisterFormat(name string, fn func(opts Options) Renderer) {
+	renderers[name] = fn
+}
+
+// Formats returns the names of the registered output formats, sorted.
+func Formats() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRenderer returns the Renderer of opts.Format, text if it is empty.
+func newRenderer(opts Options) (Renderer, error) {
+	format := opts.Format
+	if format == "" {
+		format = "text"
+	}
+	fn, ok := renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, must be one of %v", opts.Format, Formats())
+	}
+	return fn(opts), nil
+}
+
+// diffLine is a line of a rendered hunk.
+type diffLine struct {
+	// Action is Create or Delete for changed lines, NoOp for unchanged lines.
+	Action Action
+	// Old and New are the line numbers, 0 on the side the line is missing.
+	Old, New int
+	Text     string
+	// Skip marks unchanged lines that are not shown, Text is empty then.
+	Skip bool
+}
+
+// diffLines returns the lines of chunks, with unchanged lines replaced by a
+// Skip line, except for the context lines around changes.
+func diffLines(chunks []Chunk, context int) []diffLine {
+	lines := make([]diffLine, 0)
+	oidx, nidx := 1, 1
+	for i, c := range chunks {
+		for _, line := range c.Added {
+			lines = append(lines, diffLine{Action: Create, New: nidx, Text: line})
+			nidx++
+		}
+		for _, line := range c.Deleted {
+			lines = append(lines, diffLine{Action: Delete, Old: oidx, Text: line})
+			oidx++
+		}
+		if len(c.Equal) > 0 {
+			// lines after the changes of this chunk, and before the changes of the next one
+			head, tail := 0, 0
+			if len(c.Added)+len(c.Deleted) > 0 {
+				head = context
+			}
+			if i < len(chunks)-1 {
+				tail = context
+			}
+			for j, line := range c.Equal {
+				if j == head && head+tail < len(c.Equal) {
+					lines = append(lines, diffLine{Skip: true})
+				}
+				if j < head || j >= len(c.Equal)-tail {
+					lines = append(lines, diffLine{Old: oidx + j, New: nidx + j, Text: line})
+				}
+			}
+		}
+		oidx += len(c.Equal)
+		nidx += len(c.Equal)
+	}
+	return lines
+}
+
+// keyLines returns the lines of a field that is not a block, each prefixed by
+// its key, e.g. "owner: root", without line numbers.
+func keyLines(field *Field) []diffLine {
+	lines := make([]diffLine, 0)
+	for _, c := range field.Chunks {
+		for _, line := range c.Added {
+			lines = append(lines, diffLine{Action: Create, Text: field.Key + ": " + line})
+		}
+		for _, line := range c.Deleted {
+			lines = append(lines, diffLine{Action: Delete, Text: field.Key + ": " + line})
+		}
+		// e.g. a command that moved, see diffCommands
+		for _, line := range c.Equal {
+			lines = append(lines, diffLine{Text: field.Key + ": " + line})
+		}
+	}
+	return lines
+}
+
+// unifiedLines returns the changes of pd as lines of a unified diff, without
+// line numbers: each line starts with "+", "-" or " ".
+func unifiedLines(pd *PartDiff, context int) []string {
+	if pd.Objects == nil {
+		return unifiedChunkLines(pd.Chunks, context, "")
+	}
+	lines := make([]string, 0)
+	for _, obj := range pd.Objects {
+		lines = append(lines, unifiedObjectLines(obj, context)...)
+	}
+	return lines
+}
+
+// unifiedObjectLines returns the changes of obj as lines of a unified diff, see unifiedLines.
+func unifiedObjectLines(obj *Object, context int) []string {
+	lines := make([]string, 0)
+	indent := ""
+	if obj.Path != "" {
+		lines = append(lines, fmt.Sprintf("%s- %s: %s", unifiedSymbol(obj.Action), obj.label(), obj.Path))
+		indent = "  "
+	}
+	for _, field := range obj.Fields {
+		if !field.Block {
+			for _, l := range keyLines(field) {
+				lines = append(lines, unifiedSymbol(l.Action)+indent+l.Text)
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s%s%s:", unifiedSymbol(field.Action), indent, field.Key))
+		lines = append(lines, unifiedChunkLines(field.Chunks, context, indent+"  ")...)
+	}
+	return lines
+}
+
+// unifiedChunkLines returns the lines of chunks prefixed by their symbol and indent.
+func unifiedChunkLines(chunks []Chunk, context int, indent string) []string {
+	lines := make([]string, 0)
+	for _, l := range diffLines(chunks, context) {
+		if l.Skip {
+			lines = append(lines, " "+indent+"...")
+			continue
+		}
+		lines = append(lines, unifiedSymbol(l.Action)+indent+l.Text)
+	}
+	return lines
+}
+func unifiedSymbol(action Action) string {
+	switch action {
+	case Create, Delete:
+		return string(action)
+	default:
+		return " "
+	}
+}
@@ -0,0 +1,208 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// annotation is a finding reported inline by a CI system: a changed file or
+// part, a schema error, a size over the limit, or a policy violation.
+type annotation struct {
+	Severity Severity
+	// Address of the resource, empty when comparing blobs.
+	Address string
+	// Check is the kind of finding, e.g. "write_files", or "policy/" followed by the rule name.
+	Check   string
+	Title   string
+	Message string
+}
+
+// resultAnnotations returns an annotation per changed part, or per changed
+// write_files path of cloud-config parts, then per decode diagnostic and policy violation.
+func resultAnnotations(address string, res *Result) []annotation {
+	annotations := make([]annotation, 0)
+	if res == nil {
+		return annotations
+	}
+	for _, pd := range res.Parts {
+		if pd.Objects == nil {
+			inserted, deleted := pd.LineCounts()
+			annotations = append(annotations, annotation{SeverityWarning, address, "part", pd.Name(),
+				fmt.Sprintf("part %s %s (+%d -%d)", pd.Name(), actionName(pd.Action), inserted, deleted)})
+			continue
+		}
+		for _, obj := range pd.Objects {
+			inserted, deleted := obj.LineCounts()
+			if obj.Path == "" {
+				for _, field := range obj.Fields {
+					inserted, deleted := chunkLineCounts(field.Chunks)
+					annotations = append(annotations, annotation{SeverityWarning, address, "cloud-config", field.Key,
+						fmt.Sprintf("%s %s (+%d -%d)", field.Key, actionName(field.Action), inserted, deleted)})
+				}
+				continue
+			}
+			if obj.Key != "" {
+				annotations = append(annotations, annotation{SeverityWarning, address, obj.Key, obj.Path,
+					fmt.Sprintf("%s %s (+%d -%d)", obj.Name(), actionName(obj.Action), inserted, deleted)})
+				continue
+			}
+			annotations = append(annotations, annotation{SeverityWarning, address, "write_files", obj.Path,
+				fmt.Sprintf("write_files %s %s (+%d -%d)", obj.Path, actionName(obj.Action), inserted, deleted)})
+		}
+	}
+	for _, diag := range res.Diagnostics {
+		annotations = append(annotations, annotation{SeverityWarning, address, "decode", diag.Path,
+			fmt.Sprintf("decode (%s) %s %s", diag.Side, diag.Part, diag)})
+	}
+	return append(annotations, violationAnnotations(res.Violations)...)
+}
+
+// planAnnotations returns the annotations of every resource of res, then of the policy violations.
+func planAnnotations(res *PlanResult) []annotation {
+	annotations := make([]annotation, 0)
+	for _, rd := range res.Resources {
+		if rd.Masked() {
+			beforeState, afterState := rd.states()
+			annotations = append(annotations, annotation{SeverityWarning, rd.Address, "masked", rd.Arg,
+				fmt.Sprintf("%s: %s -> %s", rd.Arg, beforeState, afterState)})
+		} else {
+			annotations = append(annotations, resultAnnotations(rd.Address, rd.Result)...)
+		}
+		for _, e := range rd.SchemaErrors {
+			annotations = append(annotations, annotation{SeverityWarning, rd.Address, "schema", "schema",
+				fmt.Sprintf("schema (%s) %s %s", e.Side, e.Part, e)})
+		}
+		if rd.OverSizeLimit() {
+			annotations = append(annotations, annotation{SeverityError, rd.Address, "size-limit", "size",
+				fmt.Sprintf("%s is %s, over the %s limit of %s", rd.Arg, formatBytes(rd.SizeAfter.Payload()), rd.Type, formatBytes(rd.SizeLimit))})
+		}
+	}
+	return append(annotations, violationAnnotations(res.Violations)...)
+}
+
+// violationAnnotations returns an annotation per policy violation.
+func violationAnnotations(violations []Violation) []annotation {
+	annotations := make([]annotation, 0, len(violations))
+	for _, v := range violations {
+		message := fmt.Sprintf("%s: %s", v.location(), v.message())
+		if v.Line != "" {
+			message += "\n> " + v.Line
+		}
+		annotations = append(annotations, annotation{v.Rule.Severity, v.Address, "policy/" + v.Rule.Name, v.Rule.Name, message})
+	}
+	return annotations
+}
+
+// GitHubAnnotationsRenderer writes results as GitHub Actions workflow commands,
+// e.g. "::warning file=aws_instance.this,title=/etc/motd::...", so changes show
+// up as annotations of the workflow run. The file is the resource address.
+type GitHubAnnotationsRenderer struct{}
+
+// NewGitHubAnnotationsRenderer func
+func NewGitHubAnnotationsRenderer(opts Options) *GitHubAnnotationsRenderer {
+	return &GitHubAnnotationsRenderer{}
+}
+
+// RenderResult writes an annotation per changed part or write_files path of res.
+func (r *GitHubAnnotationsRenderer) RenderResult(w io.Writer, res *Result) error {
+	return r.write(w, resultAnnotations("", res))
+}
+
+// RenderPlan writes an annotation per changed part or write_files path of
+// every resource of res, per schema error, size over the limit, and policy violation.
+func (r *GitHubAnnotationsRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	return r.write(w, planAnnotations(res))
+}
+
+func (r *GitHubAnnotationsRenderer) write(w io.Writer, annotations []annotation) error {
+	sb := strings.Builder{}
+	for _, a := range annotations {
+		command := "warning"
+		switch a.Severity {
+		case SeverityError:
+			command = "error"
+		case SeverityInfo:
+			command = "notice"
+		}
+		properties := make([]string, 0, 2)
+		if a.Address != "" {
+			properties = append(properties, "file="+githubPropertyEscaper.Replace(a.Address))
+		}
+		properties = append(properties, "title="+githubPropertyEscaper.Replace(a.Title))
+		sb.WriteString(fmt.Sprintf("::%s %s::%s\n", command, strings.Join(properties, ","), githubDataEscaper.Replace(a.Message)))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// escaping of workflow command values, see https://github.com/actions/toolkit/blob/main/packages/core/src/command.ts
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// GitLabCodeQualityRenderer writes results as a GitLab Code Quality report, a
+// JSON array of issues shown in merge requests. The path of issues is the resource address.
+type GitLabCodeQualityRenderer struct{}
+
+// NewGitLabCodeQualityRenderer func
+func NewGitLabCodeQualityRenderer(opts Options) *GitLabCodeQualityRenderer {
+	return &GitLabCodeQualityRenderer{}
+}
+
+// codeQualityIssue is an issue of a GitLab Code Quality report.
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+type codeQualityLocation struct {
+	Path  string `json:"path"`
+	Lines struct {
+		Begin int `json:"begin"`
+	} `json:"lines"`
+}
+
+// RenderResult writes an issue per changed part or write_files path of res.
+func (r *GitLabCodeQualityRenderer) RenderResult(w io.Writer, res *Result) error {
+	return r.write(w, resultAnnotations("", res))
+}
+
+// RenderPlan writes an issue per changed part or write_files path of every
+// resource of res, per schema error, size over the limit, and policy violation.
+func (r *GitLabCodeQualityRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	return r.write(w, planAnnotations(res))
+}
+
+func (r *GitLabCodeQualityRenderer) write(w io.Writer, annotations []annotation) error {
+	issues := make([]codeQualityIssue, 0, len(annotations))
+	for _, a := range annotations {
+		severity := "minor"
+		switch a.Severity {
+		case SeverityError:
+			severity = "major"
+		case SeverityInfo:
+			severity = "info"
+		}
+		// the fingerprint identifies the issue across pipelines
+		sum := sha256.Sum256([]byte(a.Address + "\x00" + a.Title + "\x00" + a.Message))
+		issue := codeQualityIssue{
+			Description: a.Message,
+			CheckName:   "diffdecoding/" + a.Check,
+			Fingerprint: hex.EncodeToString(sum[:]),
+			Severity:    severity,
+			Location:    codeQualityLocation{Path: a.Address},
+		}
+		issue.Location.Lines.Begin = 1
+		issues = append(issues, issue)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
@@ -0,0 +1,314 @@
+package diff
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// HTMLRenderer writes results as a single self-contained HTML document, with
+// a navigation sidebar, collapsible parts and files, syntax highlighting and
+// a toggle between unified and side-by-side views. It loads no external assets.
+type HTMLRenderer struct {
+	context   int
+	showSizes bool
+}
+
+// NewHTMLRenderer func
+func NewHTMLRenderer(opts Options) *HTMLRenderer {
+	return &HTMLRenderer{opts.Context, opts.ShowSizes}
+}
+
+const htmlStyle = `body{font-family:sans-serif;margin:0;display:flex}
+nav{position:sticky;top:0;height:100vh;overflow-y:auto;width:18em;flex-shrink:0;background:#f6f8fa;border-right:1px solid #d0d7de;padding:1em;box-sizing:border-box}
+nav ul{list-style:none;padding:0}nav li{margin:.3em 0;word-break:break-all}nav small{color:#57606a}
+main{flex-grow:1;padding:1em 2em;min-width:0}
+summary{cursor:pointer;margin:.5em 0}details details{margin-left:1em}
+table.diff{border-collapse:collapse;width:100%;font-family:monospace;font-size:13px;margin-bottom:.5em}
+table.diff td{padding:0 .4em;white-space:pre-wrap;vertical-align:top}
+td.ln{color:#6e7781;text-align:right;width:3em;user-select:none}
+tr.add td.code,td.add{background:#e6ffec}tr.del td.code,td.del{background:#ffebe9}
+tr.skip td{color:#6e7781;background:#ddf4ff}tr.key td.code{font-weight:bold}
+body.unified table.split,body.split table.unified{display:none}
+.hl-comment{color:#6e7781}.hl-string{color:#0a3069}.hl-keyword{color:#cf222e}
+.hl-variable{color:#953800}.hl-key{color:#0550ae}.hl-section{color:#8250df}
+.error{color:#cf222e}.warning{color:#9a6700}`
+
+const htmlScript = `function setView(v){document.body.className=v}`
+
+// htmlRow is a row of a diff table.
+type htmlRow struct {
+	diffLine
+	// Key marks the row of a multi-line write_files key, e.g. "content:".
+	Key bool
+	// Lang is the language of Text, see highlightLanguage.
+	Lang string
+}
+
+// RenderResult writes the changed parts of res, then the policy violations.
+func (r *HTMLRenderer) RenderResult(w io.Writer, res *Result) error {
+	sb := strings.Builder{}
+	r.writeHeader(&sb)
+	sb.WriteString("<nav>\n")
+	r.writeViewToggle(&sb)
+	sb.WriteString("<ul>\n")
+	for i, pd := range res.Parts {
+		sb.WriteString(fmt.Sprintf("<li><a href=\"#p%d\">%s</a> <small>%s</small></li>\n", i, html.EscapeString(pd.Name()), actionName(pd.Action)))
+	}
+	sb.WriteString("</ul>\n</nav>\n<main>\n")
+	for i, pd := range res.Parts {
+		r.writePart(&sb, fmt.Sprintf("p%d", i), pd)
+	}
+	if len(res.Diagnostics) > 0 {
+		sb.WriteString("<ul>\n")
+		writeHTMLDiagnostics(&sb, res.Diagnostics)
+		sb.WriteString("</ul>\n")
+	}
+	if len(res.Violations) > 0 {
+		r.writeViolations(&sb, res.Violations)
+	}
+	sb.WriteString("</main>\n")
+	r.writeFooter(&sb)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// RenderPlan writes a section per resource of res, then the policy violations.
+func (r *HTMLRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	sb := strings.Builder{}
+	r.writeHeader(&sb)
+	sb.WriteString("<nav>\n")
+	r.writeViewToggle(&sb)
+	sb.WriteString("<ul>\n")
+	for i, rd := range res.Resources {
+		added, removed, changed := rd.Result.fileCounts()
+		sb.WriteString(fmt.Sprintf("<li><a href=\"#r%d\">%s</a> <small>+%d -%d ~%d</small></li>\n", i, html.EscapeString(rd.Address), added, removed, changed))
+	}
+	if len(res.Violations) > 0 {
+		sb.WriteString(fmt.Sprintf("<li><a href=\"#violations\">Policy violations</a> <small>%d</small></li>\n", len(res.Violations)))
+	}
+	sb.WriteString("</ul>\n</nav>\n<main>\n")
+	if len(res.Resources) == 0 {
+		sb.WriteString("<p>No changes.</p>\n")
+	}
+	for i, rd := range res.Resources {
+		r.writeResource(&sb, fmt.Sprintf("r%d", i), rd)
+	}
+	if len(res.Violations) > 0 {
+		r.writeViolations(&sb, res.Violations)
+	}
+	sb.WriteString("</main>\n")
+	r.writeFooter(&sb)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (r *HTMLRenderer) writeHeader(sb *strings.Builder) {
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>diffdecoding</title>\n")
+	sb.WriteString("<style>\n" + htmlStyle + "\n</style>\n<script>\n" + htmlScript + "\n</script>\n</head>\n<body class=\"unified\">\n")
+}
+func (r *HTMLRenderer) writeFooter(sb *strings.Builder) {
+	sb.WriteString("</body>\n</html>\n")
+}
+func (r *HTMLRenderer) writeViewToggle(sb *strings.Builder) {
+	sb.WriteString("<h1>diffdecoding</h1>\n<p>\n<label><input type=\"radio\" name=\"view\" onclick=\"setView('unified')\" checked> Unified</label>\n")
+	sb.WriteString("<label><input type=\"radio\" name=\"view\" onclick=\"setView('split')\"> Side by side</label>\n</p>\n")
+}
+
+func (r *HTMLRenderer) writeResource(sb *strings.Builder, id string, rd *ResourceDiff) {
+	sb.WriteString(fmt.Sprintf("<section id=\"%s\">\n<h2>%s</h2>\n", id, html.EscapeString(rd.Address)))
+	defer sb.WriteString("</section>\n")
+	if rd.Masked() {
+		beforeState, afterState := rd.states()
+		sb.WriteString(fmt.Sprintf("<p><code>%s</code>: %s -&gt; %s</p>\n", html.EscapeString(rd.Arg), html.EscapeString(beforeState), html.EscapeString(afterState)))
+		if rd.OverSizeLimit() {
+			sb.WriteString("<ul>\n")
+			writeHTMLSizeLimit(sb, rd)
+			sb.WriteString("</ul>\n")
+		}
+		return
+	}
+	if sizes := rd.sizes(r.showSizes); sizes != "" {
+		sb.WriteString(fmt.Sprintf("<p>Size: %s</p>\n", html.EscapeString(sizes)))
+	}
+	for i, pd := range rd.Result.Parts {
+		r.writePart(sb, fmt.Sprintf("%s-p%d", id, i), pd)
+	}
+	if len(rd.SchemaErrors) == 0 && len(rd.Result.Diagnostics) == 0 && !rd.OverSizeLimit() {
+		return
+	}
+	sb.WriteString("<ul>\n")
+	for _, e := range rd.SchemaErrors {
+		sb.WriteString(fmt.Sprintf("<li class=\"warning\">schema (%s) %s %s</li>\n", e.Side, html.EscapeString(e.Part), html.EscapeString(e.String())))
+	}
+	writeHTMLDiagnostics(sb, rd.Result.Diagnostics)
+	writeHTMLSizeLimit(sb, rd)
+	sb.WriteString("</ul>\n")
+}
+func writeHTMLSizeLimit(sb *strings.Builder, rd *ResourceDiff) {
+	if rd.OverSizeLimit() {
+		sb.WriteString(fmt.Sprintf("<li class=\"error\">size: %s is %s, over the %s limit of %s</li>\n",
+			html.EscapeString(rd.Arg), formatBytes(rd.SizeAfter.Payload()), html.EscapeString(rd.Type), formatBytes(rd.SizeLimit)))
+	}
+}
+
+func writeHTMLDiagnostics(sb *strings.Builder, diagnostics []DecodeDiagnostic) {
+	for _, diag := range diagnostics {
+		sb.WriteString(fmt.Sprintf("<li class=\"warning\">decode (%s) %s %s</li>\n", diag.Side, html.EscapeString(diag.Part), html.EscapeString(diag.String())))
+	}
+}
+
+// writePart writes pd as a collapsible section, holding a collapsible section
+// per write_files path for cloud-config parts.
+func (r *HTMLRenderer) writePart(sb *strings.Builder, id string, pd *PartDiff) {
+	sb.WriteString(fmt.Sprintf("<details id=\"%s\" open>\n<summary><code>%s</code> %s%s</summary>\n", id, html.EscapeString(pd.Name()), actionName(pd.Action),
+		htmlEncoding(pd.EncodingBefore, pd.EncodingAfter)))
+	defer sb.WriteString("</details>\n")
+	if pd.Objects == nil {
+		lang := highlightLanguage(pd.ContentType(), pd.Filename())
+		rows := make([]htmlRow, 0)
+		for _, l := range diffLines(pd.Chunks, r.context) {
+			rows = append(rows, htmlRow{diffLine: l, Lang: lang})
+		}
+		r.writeTables(sb, rows)
+		return
+	}
+	for _, obj := range pd.Objects {
+		path := obj.Name()
+		if obj.Occurrence > 0 {
+			path = fmt.Sprintf("%s (occurrence %d)", path, obj.Occurrence+1)
+		}
+		sb.WriteString(fmt.Sprintf("<details open>\n<summary><code>%s</code> %s%s</summary>\n", html.EscapeString(path), actionName(obj.Action),
+			htmlEncoding(obj.EncodingBefore, obj.EncodingAfter)))
+		r.writeTables(sb, objectRows(obj, r.context))
+		sb.WriteString("</details>\n")
+	}
+}
+
+// htmlEncoding returns the encodings of a part or file for display in its summary, "" if it isn't encoded.
+func htmlEncoding(before, after EncodingChain) string {
+	if encoding := formatEncodings(before, after); encoding != "" {
+		return fmt.Sprintf(" <small>encoding: %s</small>", html.EscapeString(encoding))
+	}
+	return ""
+}
+
+// objectRows returns the rows of the changed keys of obj; the content is
+// highlighted based on the file extension.
+func objectRows(obj *Object, context int) []htmlRow {
+	rows := make([]htmlRow, 0)
+	for _, field := range obj.Fields {
+		if !field.Block {
+			for _, l := range keyLines(field) {
+				rows = append(rows, htmlRow{diffLine: l, Lang: "yaml"})
+			}
+			continue
+		}
+		rows = append(rows, htmlRow{diffLine: diffLine{Action: field.Action, Text: field.Key + ":"}, Key: true})
+		lang := ""
+		if field.Key == "content" {
+			lang = highlightLanguage("", obj.Path)
+		}
+		for _, l := range diffLines(field.Chunks, context) {
+			rows = append(rows, htmlRow{diffLine: l, Lang: lang})
+		}
+	}
+	return rows
+}
+
+// writeTables writes rows as a unified table and a side-by-side table, one of
+// them is hidden depending on the selected view.
+func (r *HTMLRenderer) writeTables(sb *strings.Builder, rows []htmlRow) {
+	sb.WriteString("<table class=\"diff unified\">\n")
+	for _, row := range rows {
+		sb.WriteString(fmt.Sprintf("<tr class=\"%s\"><td class=\"ln\">%s</td><td class=\"ln\">%s</td><td class=\"code\">%s</td></tr>\n",
+			rowClass(row), lineNumber(row.Old), lineNumber(row.New), rowCode(row, true)))
+	}
+	sb.WriteString("</table>\n<table class=\"diff split\">\n")
+	for i := 0; i < len(rows); {
+		if !rows[i].changed() {
+			code := rowCode(rows[i], false)
+			sb.WriteString(fmt.Sprintf("<tr class=\"%s\"><td class=\"ln\">%s</td><td class=\"code\">%s</td><td class=\"ln\">%s</td><td class=\"code\">%s</td></tr>\n",
+				rowClass(rows[i]), lineNumber(rows[i].Old), code, lineNumber(rows[i].New), code))
+			i++
+			continue
+		}
+		// pair the deleted and added lines of a run of changes
+		deleted, added := make([]htmlRow, 0), make([]htmlRow, 0)
+		for ; i < len(rows) && rows[i].changed(); i++ {
+			if rows[i].Action == Delete {
+				deleted = append(deleted, rows[i])
+			} else {
+				added = append(added, rows[i])
+			}
+		}
+		for j := 0; j < len(deleted) || j < len(added); j++ {
+			sb.WriteString("<tr>")
+			if j < len(deleted) {
+				sb.WriteString(fmt.Sprintf("<td class=\"ln\">%s</td><td class=\"code del\">%s</td>", lineNumber(deleted[j].Old), rowCode(deleted[j], false)))
+			} else {
+				sb.WriteString("<td class=\"ln\"></td><td></td>")
+			}
+			if j < len(added) {
+				sb.WriteString(fmt.Sprintf("<td class=\"ln\">%s</td><td class=\"code add\">%s</td>", lineNumber(added[j].New), rowCode(added[j], false)))
+			} else {
+				sb.WriteString("<td class=\"ln\"></td><td></td>")
+			}
+			sb.WriteString("</tr>\n")
+		}
+	}
+	sb.WriteString("</table>\n")
+}
+
+// changed reports whether row is an added or deleted line.
+func (row htmlRow) changed() bool {
+	return !row.Key && !row.Skip && (row.Action == Create || row.Action == Delete)
+}
+
+func rowClass(row htmlRow) string {
+	switch {
+	case row.Skip:
+		return "skip"
+	case row.Key:
+		return "key"
+	case row.Action == Create:
+		return "add"
+	case row.Action == Delete:
+		return "del"
+	default:
+		return ""
+	}
+}
+
+// rowCode returns the highlighted text of row, prefixed by its diff symbol in the unified view.
+func rowCode(row htmlRow, unified bool) string {
+	if row.Skip {
+		return "..."
+	}
+	code := highlight(row.Lang, row.Text)
+	if unified {
+		code = html.EscapeString(unifiedSymbol(row.Action)) + " " + code
+	}
+	return code
+}
+func lineNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
+
+func (r *HTMLRenderer) writeViolations(sb *strings.Builder, violations []Violation) {
+	sb.WriteString("<section id=\"violations\">\n<h2>Policy violations</h2>\n<ul>\n")
+	for _, v := range violations {
+		location, message := v.location(), v.message()
+		sb.WriteString(fmt.Sprintf("<li class=\"%s\">[%s] %s: %s: %s", v.Rule.Severity, v.Rule.Severity,
+			html.EscapeString(v.Rule.Name), html.EscapeString(location), html.EscapeString(message)))
+		if v.Line != "" {
+			sb.WriteString(fmt.Sprintf("<pre>%s</pre>", html.EscapeString(v.Line)))
+		}
+		sb.WriteString("</li>\n")
+	}
+	sb.WriteString("</ul>\n</section>\n")
+}
@@ -0,0 +1,253 @@
+package diff
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// MarkdownRenderer writes results as GitHub flavored markdown, suitable for
+// pull request comments: a summary table of resources, then a collapsible
+// section per resource and per write_files path, with changes in ```diff fenced blocks.
+type MarkdownRenderer struct {
+	context   int
+	showSizes bool
+	// sizeLimit is the maximum size of the output in bytes, 0 for no limit.
+	sizeLimit int
+}
+
+// NewMarkdownRenderer func
+func NewMarkdownRenderer(opts Options) *MarkdownRenderer {
+	return &MarkdownRenderer{opts.Context, opts.ShowSizes, opts.CommentSizeLimit}
+}
+
+// RenderResult writes the decode diagnostics and policy violations of res, then its changed parts.
+func (r *MarkdownRenderer) RenderResult(w io.Writer, res *Result) error {
+	head := strings.Builder{}
+	writeMarkdownDiagnostics(&head, res.Diagnostics)
+	if len(res.Diagnostics) > 0 {
+		head.WriteString("\n")
+	}
+	if len(res.Violations) > 0 {
+		r.writeViolations(&head, res.Violations)
+	}
+	sections := make([]string, 0, len(res.Parts))
+	for _, pd := range res.Parts {
+		sb := strings.Builder{}
+		r.writePart(&sb, pd)
+		sections = append(sections, sb.String())
+	}
+	_, err := io.WriteString(w, r.truncate(head.String(), nil, "", sections, "parts"))
+	return err
+}
+
+// RenderPlan writes a summary table of the resources of res and the policy
+// violations, then a section per resource.
+func (r *MarkdownRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	title := "### User data changes\n\n"
+	if len(res.Resources) == 0 {
+		title += "No changes.\n"
+	}
+	violations := strings.Builder{}
+	if len(res.Violations) > 0 {
+		r.writeViolations(&violations, res.Violations)
+	}
+	sections := make([]string, 0, len(res.Resources))
+	for _, rd := range res.Resources {
+		section := strings.Builder{}
+		r.writeResource(&section, rd)
+		sections = append(sections, section.String())
+	}
+	_, err := io.WriteString(w, r.truncate(title, summaryRows(res.Resources), violations.String(), sections, "resources"))
+	return err
+}
+
+// summaryHeader is the header of the summary table of RenderPlan.
+const summaryHeader = "| Resource | Added | Removed | Changed | Notes |\n|---|---:|---:|---:|---|\n"
+
+// truncate returns title, a summary table of rows if any, tail, and as many
+// sections as fit in the size limit, with a notice if some are left out. The
+// rows that don't fit are counted in a last row; a section that doesn't fit is
+// left out, and the smaller ones after it may still fit.
+func (r *MarkdownRenderer) truncate(title string, rows []string, tail string, sections []string, what string) string {
+	table := func(n int) string {
+		if len(rows) == 0 {
+			return ""
+		}
+		t := summaryHeader + strings.Join(rows[:n], "")
+		if n < len(rows) {
+			t += fmt.Sprintf("| and %d more | | | | |\n", len(rows)-n)
+		}
+		return t + "\n"
+	}
+	out := title + table(len(rows)) + tail + strings.Join(sections, "")
+	if r.sizeLimit <= 0 || len(out) <= r.sizeLimit {
+		return out
+	}
+	notice := func(n int) string {
+		return fmt.Sprintf("> [!WARNING]\n> Output truncated: %d of %d %s shown, the full report is over the comment size limit of %s.\n",
+			n, len(sections), what, formatBytes(r.sizeLimit))
+	}
+	// the notice is at its longest with every section shown
+	reserved := len(title) + len(tail) + len(notice(len(sections)))
+	n := len(rows)
+	for n > 0 && reserved+len(table(n)) > r.sizeLimit {
+		n--
+	}
+	sb := strings.Builder{}
+	sb.WriteString(title + table(n) + tail)
+	shown := 0
+	for _, section := range sections {
+		if sb.Len()+len(section)+len(notice(len(sections))) > r.sizeLimit {
+			continue
+		}
+		sb.WriteString(section)
+		shown++
+	}
+	sb.WriteString(notice(shown))
+	return sb.String()
+}
+
+// summaryRows returns a row of the summary table per resource.
+func summaryRows(resources []*ResourceDiff) []string {
+	rows := make([]string, 0, len(resources))
+	for _, rd := range resources {
+		notes := make([]string, 0)
+		if rd.Masked() {
+			beforeState, afterState := rd.states()
+			notes = append(notes, fmt.Sprintf("%s -> %s", beforeState, afterState))
+		}
+		if len(rd.SchemaErrors) > 0 {
+			notes = append(notes, fmt.Sprintf("%d schema errors", len(rd.SchemaErrors)))
+		}
+		if rd.OverSizeLimit() {
+			notes = append(notes, "over size limit")
+		}
+		added, removed, changed := rd.Result.fileCounts()
+		rows = append(rows, fmt.Sprintf("| `%s` | %d | %d | %d | %s |\n", rd.Address, added, removed, changed, strings.Join(notes, ", ")))
+	}
+	return rows
+}
+
+func (r *MarkdownRenderer) writeResource(sb *strings.Builder, rd *ResourceDiff) {
+	added, removed, changed := rd.Result.fileCounts()
+	sb.WriteString(fmt.Sprintf("<details>\n<summary><code>%s</code>: %d added, %d removed, %d changed</summary>\n\n",
+		html.EscapeString(rd.Address), added, removed, changed))
+	defer sb.WriteString("</details>\n\n")
+	if rd.Masked() {
+		beforeState, afterState := rd.states()
+		sb.WriteString(fmt.Sprintf("`%s`: %s -> %s\n\n", rd.Arg, beforeState, afterState))
+		if rd.OverSizeLimit() {
+			writeMarkdownSizeLimit(sb, rd)
+			sb.WriteString("\n")
+		}
+		return
+	}
+	if sizes := rd.sizes(r.showSizes); sizes != "" {
+		sb.WriteString(fmt.Sprintf("Size: %s\n\n", sizes))
+	}
+	for _, pd := range rd.Result.Parts {
+		r.writePart(sb, pd)
+	}
+	for _, e := range rd.SchemaErrors {
+		sb.WriteString(fmt.Sprintf("- :warning: schema (%s) `%s` %s\n", e.Side, e.Part, markdownEscape(e.String())))
+	}
+	writeMarkdownDiagnostics(sb, rd.Result.Diagnostics)
+	writeMarkdownSizeLimit(sb, rd)
+	if len(rd.SchemaErrors) > 0 || len(rd.Result.Diagnostics) > 0 || rd.OverSizeLimit() {
+		sb.WriteString("\n")
+	}
+}
+func writeMarkdownSizeLimit(sb *strings.Builder, rd *ResourceDiff) {
+	if rd.OverSizeLimit() {
+		sb.WriteString(fmt.Sprintf("- :x: size: `%s` is %s, over the `%s` limit of %s\n",
+			rd.Arg, formatBytes(rd.SizeAfter.Payload()), rd.Type, formatBytes(rd.SizeLimit)))
+	}
+}
+
+// writePart writes a cloud-config part as a collapsible section per
+// write_files path, and any other part as a single diff block.
+func (r *MarkdownRenderer) writePart(sb *strings.Builder, pd *PartDiff) {
+	sb.WriteString(fmt.Sprintf("**`%s`**%s\n\n", pd.Name(), markdownEncoding(pd.EncodingBefore, pd.EncodingAfter)))
+	if pd.Objects == nil {
+		writeDiffBlock(sb, unifiedLines(pd, r.context))
+		return
+	}
+	for _, obj := range pd.Objects {
+		path := obj.Name()
+		if obj.Occurrence > 0 {
+			path = fmt.Sprintf("%s (occurrence %d)", path, obj.Occurrence+1)
+		}
+		sb.WriteString(fmt.Sprintf("<details>\n<summary><code>%s</code> %s%s</summary>\n\n", html.EscapeString(path), actionName(obj.Action),
+			htmlEncoding(obj.EncodingBefore, obj.EncodingAfter)))
+		writeDiffBlock(sb, unifiedObjectLines(obj, r.context))
+		sb.WriteString("</details>\n\n")
+	}
+}
+
+// writeMarkdownDiagnostics writes a list item per decode diagnostic.
+func writeMarkdownDiagnostics(sb *strings.Builder, diagnostics []DecodeDiagnostic) {
+	for _, diag := range diagnostics {
+		path := ""
+		if diag.Path != "" {
+			path = fmt.Sprintf(" `%s`", diag.Path)
+		}
+		sb.WriteString(fmt.Sprintf("- :warning: decode (%s) `%s`%s: %s\n", diag.Side, diag.Part, path, markdownEscape(diag.Message)))
+	}
+}
+
+// markdownEncoding returns the encodings of a part for display after its name, "" if it isn't encoded.
+func markdownEncoding(before, after EncodingChain) string {
+	if encoding := formatEncodings(before, after); encoding != "" {
+		return fmt.Sprintf(" (encoding: `%s`)", encoding)
+	}
+	return ""
+}
+
+// actionName returns the past participle of action, e.g. "added".
+func actionName(action Action) string {
+	switch action {
+	case Create:
+		return "added"
+	case Delete:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+// writeDiffBlock writes lines in a ```diff fenced block, with a fence longer
+// than any run of backticks in lines.
+func writeDiffBlock(sb *strings.Builder, lines []string) {
+	fence := "```"
+	for _, line := range lines {
+		for strings.Contains(line, fence) {
+			fence += "`"
+		}
+	}
+	sb.WriteString(fence + "diff\n")
+	for _, line := range lines {
+		sb.WriteString(line + "\n")
+	}
+	sb.WriteString(fence + "\n\n")
+}
+
+func (r *MarkdownRenderer) writeViolations(sb *strings.Builder, violations []Violation) {
+	sb.WriteString("### Policy violations\n\n")
+	for _, v := range violations {
+		location, message := v.location(), v.message()
+		sb.WriteString(fmt.Sprintf("- **%s** `%s`: `%s`: %s\n", v.Rule.Severity, v.Rule.Name, location, markdownEscape(message)))
+		if v.Line != "" {
+			sb.WriteString(fmt.Sprintf("  `%s`\n", strings.ReplaceAll(v.Line, "`", "'")))
+		}
+	}
+	sb.WriteString("\n")
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "<", "&lt;", ">", "&gt;", "|", `\|`, "[", `\[`, "]", `\]`)
+
+// markdownEscape escapes s for use in markdown text outside of code.
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
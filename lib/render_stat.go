@@ -0,0 +1,175 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mitchellh/colorstring"
+)
+
+// statGraphWidth is the maximum width of the +/- graph of the stat format.
+const statGraphWidth = 40
+
+// StatRenderer writes the number of inserted and deleted lines, like "git diff --stat".
+// The stat format has a line per resource, per part and per write_files path,
+// the summary format a line per resource; both end with totals.
+type StatRenderer struct {
+	color   *colorstring.Colorize
+	summary bool
+}
+
+// NewStatRenderer func
+// returns a StatRenderer of the stat format, or of the summary format if summary is set.
+func NewStatRenderer(opts Options, summary bool) *StatRenderer {
+	color := &colorstring.Colorize{
+		Colors:  colorstring.DefaultColors,
+		Disable: opts.NoColor,
+		Reset:   true,
+	}
+	return &StatRenderer{color, summary}
+}
+
+// statRow is a line of the stat format.
+type statRow struct {
+	name              string
+	inserted, deleted int
+	// note replaces the counts of resources whose value is masked.
+	note string
+}
+
+// RenderResult writes the counts of every part of res and its write_files paths, then the totals.
+func (r *StatRenderer) RenderResult(w io.Writer, res *Result) error {
+	rows := r.resultRows(res)
+	sb := strings.Builder{}
+	r.writeRows(&sb, rows, maxChanges(rows))
+	inserted, deleted := res.LineCounts()
+	sb.WriteString(" " + statTotals(0, len(res.Parts), inserted, deleted))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// RenderPlan writes the counts of every resource of res, then the totals.
+func (r *StatRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	rows := make([][]statRow, len(res.Resources))
+	parts, inserted, deleted := 0, 0, 0
+	for i, rd := range res.Resources {
+		ins, del := rd.Result.LineCounts()
+		inserted, deleted = inserted+ins, deleted+del
+		if rd.Result != nil {
+			parts += len(rd.Result.Parts)
+		}
+		switch {
+		case rd.Masked():
+			beforeState, afterState := rd.states()
+			name := rd.Arg
+			if r.summary {
+				name = rd.Address
+			}
+			rows[i] = []statRow{{name: name, note: fmt.Sprintf("%s -> %s", beforeState, afterState)}}
+		case r.summary:
+			rows[i] = []statRow{{name: rd.Address, inserted: ins, deleted: del}}
+		default:
+			rows[i] = r.resultRows(rd.Result)
+		}
+	}
+	max := 0
+	for _, rs := range rows {
+		if m := maxChanges(rs); m > max {
+			max = m
+		}
+	}
+	sb := strings.Builder{}
+	if r.summary {
+		all := make([]statRow, 0, len(rows))
+		for _, rs := range rows {
+			all = append(all, rs...)
+		}
+		r.writeRows(&sb, all, max)
+	} else {
+		for i, rd := range res.Resources {
+			sb.WriteString(r.color.Color(fmt.Sprintf("[cyan]@@ %s[reset]\n", rd.Address)))
+			r.writeRows(&sb, rows[i], max)
+		}
+	}
+	sb.WriteString(" " + statTotals(len(res.Resources), parts, inserted, deleted))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// resultRows returns a row per part of res, followed by a row per write_files path of the part.
+func (r *StatRenderer) resultRows(res *Result) []statRow {
+	rows := make([]statRow, 0)
+	if res == nil {
+		return rows
+	}
+	for _, pd := range res.Parts {
+		inserted, deleted := pd.LineCounts()
+		rows = append(rows, statRow{name: pd.Name(), inserted: inserted, deleted: deleted})
+		for _, obj := range pd.Objects {
+			inserted, deleted := obj.LineCounts()
+			rows = append(rows, statRow{name: "  " + obj.Name(), inserted: inserted, deleted: deleted})
+		}
+	}
+	return rows
+}
+
+// writeRows writes rows with aligned names and counts, and a graph scaled so the
+// longest one, of max changes, fits in statGraphWidth.
+func (r *StatRenderer) writeRows(sb *strings.Builder, rows []statRow, max int) {
+	nameWidth, countWidth := 0, len(fmt.Sprint(max))
+	for _, row := range rows {
+		if len(row.name) > nameWidth {
+			nameWidth = len(row.name)
+		}
+	}
+	for _, row := range rows {
+		if row.note != "" {
+			sb.WriteString(fmt.Sprintf(" %-*s | %s\n", nameWidth, row.name, row.note))
+			continue
+		}
+		inserted, deleted := row.inserted, row.deleted
+		if max > statGraphWidth {
+			inserted, deleted = scaleChanges(inserted, max), scaleChanges(deleted, max)
+		}
+		graph := fmt.Sprintf("[green]%s[reset][red]%s[reset]", strings.Repeat("+", inserted), strings.Repeat("-", deleted))
+		line := fmt.Sprintf(" %-*s | %*d %s", nameWidth, row.name, countWidth, row.inserted+row.deleted, r.color.Color(graph))
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+}
+
+// scaleChanges scales n changes to statGraphWidth for max changes, keeping at least one.
+func scaleChanges(n, max int) int {
+	if n == 0 {
+		return 0
+	}
+	if scaled := n * statGraphWidth / max; scaled > 0 {
+		return scaled
+	}
+	return 1
+}
+func maxChanges(rows []statRow) int {
+	max := 0
+	for _, row := range rows {
+		if row.inserted+row.deleted > max {
+			max = row.inserted + row.deleted
+		}
+	}
+	return max
+}
+
+// statTotals returns the totals line, e.g. "1 resource, 2 parts changed, 3 insertions(+), 1 deletion(-)".
+func statTotals(resources, parts, inserted, deleted int) string {
+	counts := make([]string, 0, 4)
+	if resources > 0 {
+		counts = append(counts, plural(resources, "resource"))
+	}
+	counts = append(counts, plural(parts, "part")+" changed", plural(inserted, "insertion")+"(+)", plural(deleted, "deletion")+"(-)")
+	return strings.Join(counts, ", ")
+}
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
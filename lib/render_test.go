@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResult() *Result {
+	return &Result{Parts: []*PartDiff{{
+		Header: textproto.MIMEHeader{"Content-Type": {"text/x-shellscript"}},
+		Action: Update,
+		Chunks: lineChunks("echo one\necho <two>", "echo one\necho 2"),
+	}}}
+}
+
+func TestRenderResult_Formats(t *testing.T) {
+	tests := []struct {
+		format string
+		expect string
+	}{
+		{"text", "Content-Type: text/x-shellscript\n   ...\n    2|      \x1b[31m-  echo <two>\n\x1b[0m     |2     \x1b[32m+  echo 2\n\x1b[0m"},
+		{"no-color", "Content-Type: text/x-shellscript\n   ...\n    2|      -  echo <two>\n     |2     +  echo 2"},
+		{"markdown", "**`text/x-shellscript`**\n\n```diff\n ...\n-echo <two>\n+echo 2\n```\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			d, err := NewWithOptions(Options{Format: tt.format})
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			assert.NoError(t, d.RenderResult(&buf, testResult()))
+			assert.Equal(t, tt.expect, buf.String())
+		})
+	}
+}
+
+func TestRenderResult_HTML(t *testing.T) {
+	d, err := NewWithOptions(Options{Format: "html"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, d.RenderResult(&buf, testResult()))
+	out := buf.String()
+	assert.Contains(t, out, `<li><a href="#p0">text/x-shellscript</a> <small>changed</small></li>`)
+	assert.Contains(t, out, `<tr class="del"><td class="ln">2</td><td class="ln"></td><td class="code">- echo &lt;two&gt;</td></tr>`)
+	assert.Contains(t, out, `<tr><td class="ln">2</td><td class="code del">echo &lt;two&gt;</td><td class="ln">2</td><td class="code add">echo 2</td></tr>`)
+	assert.NotContains(t, out, "src=")
+	assert.NotContains(t, out, "href=\"http")
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		contentType, filename string
+		line                  string
+		expect                string
+	}{
+		{"text/x-shellscript", "", `echo "$HOME" # home`, `echo <span class="hl-string">&#34;$HOME&#34;</span><span class="hl-comment"> # home</span>`},
+		{"text/x-shellscript", "", `if [ -n $X ]; then`, `<span class="hl-keyword">if</span> [ -n <span class="hl-variable">$X</span> ]; <span class="hl-keyword">then</span>`},
+		{"", "/etc/systemd/system/app.service", "[Service]", `<span class="hl-section">[Service]</span>`},
+		{"", "/etc/systemd/system/app.service", "[Service] Restart=always", `<span class="hl-key">[Service] Restart=</span>always`},
+		{"", "/etc/app.json", `{"a": true}`, `{<span class="hl-key">&#34;a&#34;:</span> <span class="hl-keyword">true</span>}`},
+		{"", "/etc/motd.txt", "if <b>", "if &lt;b&gt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.expect, highlight(highlightLanguage(tt.contentType, tt.filename), tt.line))
+		})
+	}
+}
+
+type countRenderer struct{}
+
+func (countRenderer) RenderResult(w io.Writer, res *Result) error {
+	_, err := fmt.Fprintf(w, "%d parts", len(res.Parts))
+	return err
+}
+func (countRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	_, err := fmt.Fprintf(w, "%d resources", len(res.Resources))
+	return err
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("count", func(opts Options) Renderer { return countRenderer{} })
+	defer delete(renderers, "count")
+	d, err := NewWithOptions(Options{Format: "count"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, d.RenderResult(&buf, testResult()))
+	assert.Equal(t, "1 parts", buf.String())
+}
+
+func TestMarkdownRenderer_RenderPlan(t *testing.T) {
+	d := New()
+	objects := d.compareYAML(scope{}, "write_files:\n- path: /etc/a\n  owner: root\n- path: /etc/b", "write_files:\n- path: /etc/a\n  owner: app\n- path: /etc/c")
+	res := &PlanResult{Resources: []*ResourceDiff{
+		{Address: "aws_instance.a", Type: "aws_instance", Arg: "user_data_base64", Result: &Result{Parts: []*PartDiff{
+			{Header: yamlHeader(), Action: Update, Objects: objects},
+			testResult().Parts[0],
+		}}},
+		{Address: "aws_instance.b", Type: "aws_instance", Arg: "user_data_base64", BeforeState: "(sensitive value)"},
+	}}
+	var buf bytes.Buffer
+	assert.NoError(t, NewMarkdownRenderer(Options{}).RenderPlan(&buf, res))
+	out := buf.String()
+	assert.Contains(t, out, "| `aws_instance.a` | 1 | 1 | 2 |  |\n| `aws_instance.b` | 0 | 0 | 0 | (sensitive value) -> (decoded value) |\n")
+	assert.Contains(t, out, "<summary><code>aws_instance.a</code>: 1 added, 1 removed, 2 changed</summary>\n\n")
+	assert.Contains(t, out, "<summary><code>/etc/a</code> changed</summary>\n\n```diff\n - path: /etc/a\n-  owner: root\n+  owner: app\n```\n\n</details>\n")
+	assert.NotContains(t, out, "truncated")
+
+	buf.Reset()
+	assert.NoError(t, NewMarkdownRenderer(Options{CommentSizeLimit: len(out) - 1}).RenderPlan(&buf, res))
+	assert.LessOrEqual(t, buf.Len(), len(out)-1)
+	assert.Contains(t, buf.String(), "<code>aws_instance.a</code>")
+	assert.NotContains(t, buf.String(), "<code>aws_instance.b</code>")
+	assert.Contains(t, buf.String(), "Output truncated: 1 of 2 resources shown")
+}
+
+func TestMarkdownRenderer_Truncate(t *testing.T) {
+	r := NewMarkdownRenderer(Options{CommentSizeLimit: 500})
+	big, small := strings.Repeat("b", 800)+"\n", "small\n"
+	out := r.truncate("title\n", nil, "", []string{big, small}, "parts")
+	assert.LessOrEqual(t, len(out), 500)
+	assert.NotContains(t, out, big)
+	assert.Contains(t, out, small)
+	assert.Contains(t, out, "Output truncated: 1 of 2 parts shown")
+
+	rows := make([]string, 100)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("| `aws_instance.r%d` | 1 | 0 | 0 |  |\n", i)
+	}
+	out = r.truncate("title\n", rows, "", []string{small}, "resources")
+	assert.LessOrEqual(t, len(out), 500)
+	assert.Regexp(t, `\| and [0-9]+ more \| \| \| \| \|\n`, out)
+	assert.Contains(t, out, "`aws_instance.r0`")
+	assert.NotContains(t, out, "`aws_instance.r99`")
+}
+
+func TestAnnotationRenderers(t *testing.T) {
+	res := &PlanResult{
+		Resources: []*ResourceDiff{{Address: "aws_instance.a", Type: "aws_instance", Arg: "user_data_base64", Result: testResult()}},
+		Violations: []Violation{{Rule: &Rule{Name: "curl-pipe-shell", Severity: SeverityError}, Address: "aws_instance.a",
+			ContentType: "text/x-shellscript", Line: "curl x | sh"}},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, NewGitHubAnnotationsRenderer(Options{}).RenderPlan(&buf, res))
+	assert.Equal(t, "::warning file=aws_instance.a,title=text/x-shellscript::part text/x-shellscript changed (+1 -1)\n"+
+		"::error file=aws_instance.a,title=curl-pipe-shell::aws_instance.a text/x-shellscript: matched%0A> curl x | sh\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, NewGitLabCodeQualityRenderer(Options{}).RenderPlan(&buf, res))
+	var issues []codeQualityIssue
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &issues))
+	assert.Len(t, issues, 2)
+	assert.Equal(t, "diffdecoding/part", issues[0].CheckName)
+	assert.Equal(t, "minor", issues[0].Severity)
+	assert.Equal(t, "aws_instance.a", issues[0].Location.Path)
+	assert.Equal(t, "diffdecoding/policy/curl-pipe-shell", issues[1].CheckName)
+	assert.Equal(t, "major", issues[1].Severity)
+	assert.Len(t, issues[1].Fingerprint, 64)
+}
+
+func TestStatRenderer(t *testing.T) {
+	d := New()
+	objects := d.compareYAML(scope{}, "write_files:\n- path: /etc/a\n  owner: root", "write_files:\n- path: /etc/a\n  owner: app\n- path: /etc/long/name")
+	res := &PlanResult{Resources: []*ResourceDiff{
+		{Address: "aws_instance.a", Arg: "user_data_base64", Result: &Result{Parts: []*PartDiff{
+			{Header: yamlHeader(), Action: Update, Objects: objects},
+			testResult().Parts[0],
+		}}},
+		{Address: "aws_instance.b", Arg: "user_data_base64", AfterState: "(known after apply)"},
+	}}
+	tests := []struct {
+		format string
+		expect string
+	}{
+		{"stat", "@@ aws_instance.a\n" +
+			" text/cloud-config  | 2 +-\n" +
+			"   /etc/a           | 2 +-\n" +
+			"   /etc/long/name   | 0\n" +
+			" text/x-shellscript | 2 +-\n" +
+			"@@ aws_instance.b\n" +
+			" user_data_base64 | (decoded value) -> (known after apply)\n" +
+			" 2 resources, 2 parts changed, 2 insertions(+), 2 deletions(-)"},
+		{"summary", " aws_instance.a | 4 ++--\n" +
+			" aws_instance.b | (decoded value) -> (known after apply)\n" +
+			" 2 resources, 2 parts changed, 2 insertions(+), 2 deletions(-)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			d, _ := NewWithOptions(Options{Format: tt.format, NoColor: true})
+			var buf bytes.Buffer
+			assert.NoError(t, d.Render(&buf, res))
+			assert.Equal(t, tt.expect, buf.String())
+		})
+	}
+}
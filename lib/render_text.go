@@ -0,0 +1,197 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mitchellh/colorstring"
+)
+
+// TextRenderer writes results as text, colored unless Options.NoColor is set.
+// It is the default format of the command line.
+type TextRenderer struct {
+	color     *colorstring.Colorize
+	context   int
+	showSizes bool
+}
+
+// NewTextRenderer func
+func NewTextRenderer(opts Options) *TextRenderer {
+	color := &colorstring.Colorize{
+		Colors:  colorstring.DefaultColors,
+		Disable: opts.NoColor,
+		Reset:   true,
+	}
+	return &TextRenderer{color, opts.Context, opts.ShowSizes}
+}
+
+// RenderResult writes the changed parts of res, then the decode diagnostics.
+func (r *TextRenderer) RenderResult(w io.Writer, res *Result) error {
+	sb := strings.Builder{}
+	r.writeParts(&sb, res.Parts)
+	r.writeDiagnostics(&sb, res.Diagnostics)
+	if len(res.Violations) > 0 {
+		sb.WriteString("\n")
+		r.writeViolations(&sb, res.Violations)
+	}
+	_, err := io.WriteString(w, strings.TrimRight(sb.String(), "\n"))
+	return err
+}
+
+// RenderPlan writes every resource of res, headed by its address, then the policy violations.
+func (r *TextRenderer) RenderPlan(w io.Writer, res *PlanResult) error {
+	sb := strings.Builder{}
+	for _, rd := range res.Resources {
+		r.writeResource(&sb, rd)
+	}
+	if len(res.Violations) > 0 {
+		sb.WriteString("\n")
+		r.writeViolations(&sb, res.Violations)
+	}
+	_, err := io.WriteString(w, strings.TrimRight(sb.String(), "\n"))
+	return err
+}
+
+func (r *TextRenderer) writeResource(sb *strings.Builder, rd *ResourceDiff) {
+	sb.WriteString(r.color.Color(fmt.Sprintf("[cyan]@@ %s[reset]\n", rd.Address)))
+	if rd.Masked() {
+		beforeState, afterState := rd.states()
+		sb.WriteString(r.color.Color(fmt.Sprintf("[yellow]%c[reset]  %s: %s -> %s\n", Update, rd.Arg, beforeState, afterState)))
+		r.writeSizeLimit(sb, rd)
+		return
+	}
+	if sizes := rd.sizes(r.showSizes); sizes != "" {
+		sb.WriteString(fmt.Sprintf("   size: %s\n", sizes))
+	}
+	parts := strings.Builder{}
+	r.writeParts(&parts, rd.Result.Parts)
+	if diffStr := strings.TrimRight(parts.String(), "\n"); diffStr != "" {
+		sb.WriteString(diffStr)
+		sb.WriteString("\n")
+	}
+	for _, e := range rd.SchemaErrors {
+		sb.WriteString(r.color.Color(fmt.Sprintf("[yellow]![reset] schema (%s) %s %s\n", e.Side, e.Part, e)))
+	}
+	r.writeDiagnostics(sb, rd.Result.Diagnostics)
+	r.writeSizeLimit(sb, rd)
+}
+func (r *TextRenderer) writeSizeLimit(sb *strings.Builder, rd *ResourceDiff) {
+	if rd.OverSizeLimit() {
+		sb.WriteString(r.color.Color(fmt.Sprintf("[red]![reset] size: %s is %s, over the %s limit of %s\n",
+			rd.Arg, formatBytes(rd.SizeAfter.Payload()), rd.Type, formatBytes(rd.SizeLimit))))
+	}
+}
+func (r *TextRenderer) writeDiagnostics(sb *strings.Builder, diagnostics []DecodeDiagnostic) {
+	for _, diag := range diagnostics {
+		sb.WriteString(r.color.Color(fmt.Sprintf("[yellow]![reset] decode (%s) %s %s\n", diag.Side, diag.Part, diag)))
+	}
+}
+func (r *TextRenderer) writeParts(sb *strings.Builder, parts []*PartDiff) {
+	for _, pd := range parts {
+		delimitedLine := fmt.Sprintf("Content-Type: %s\n", pd.ContentType())
+		if val := pd.Header.Get("Content-Disposition"); val != "" {
+			delimitedLine = fmt.Sprintf("Content-Disposition: %s\n", val)
+		}
+		if encoding := formatEncodings(pd.EncodingBefore, pd.EncodingAfter); encoding != "" {
+			delimitedLine = strings.TrimSuffix(delimitedLine, "\n") + "  # encoding: " + encoding + "\n"
+		}
+		sb.WriteString(delimitedLine)
+		if pd.Objects != nil {
+			r.writeObjects(sb, pd.Objects)
+		} else {
+			r.writeChunks(sb, pd.Chunks, 2)
+		}
+		sb.WriteString("\n")
+	}
+}
+func (r *TextRenderer) writeObjects(sb *strings.Builder, objs []*Object) {
+	for _, obj := range objs {
+		if obj.Path == "" {
+			// cloud-config keys, written at the top level
+			for _, field := range obj.Fields {
+				r.writeField(sb, field, 0)
+			}
+			continue
+		}
+		path := obj.Path
+		notes := make([]string, 0, 2)
+		if obj.Occurrence > 0 {
+			notes = append(notes, fmt.Sprintf("occurrence %d", obj.Occurrence+1))
+		}
+		if encoding := formatEncodings(obj.EncodingBefore, obj.EncodingAfter); encoding != "" {
+			notes = append(notes, "encoding: "+encoding)
+		}
+		if len(notes) > 0 {
+			path += "  # " + strings.Join(notes, ", ")
+		}
+		sb.WriteString(r.color.Color(fmt.Sprintf(diffActionSymbol(obj.Action)+"- %s: %s\n", obj.label(), path)))
+		for _, field := range obj.Fields {
+			r.writeField(sb, field, 2)
+		}
+	}
+}
+func (r *TextRenderer) writeField(sb *strings.Builder, field *Field, indentSize int) {
+	indent := strings.Repeat(" ", indentSize)
+	if !field.Block {
+		for _, l := range keyLines(field) {
+			line := diffActionSymbol(l.Action) + indent + l.Text + "\n"
+			if l.Action != NoOp {
+				line = r.color.Color(line)
+			}
+			sb.WriteString(line)
+		}
+	} else {
+		sb.WriteString(r.color.Color(diffActionSymbol(field.Action) + fmt.Sprintf("%s%s:\n", indent, field.Key)))
+		r.writeChunks(sb, field.Chunks, indentSize+2)
+	}
+}
+
+// writeChunks writes changed lines with their line numbers before and after.
+// Unchanged lines are shown as "...", except for the r.context lines around changes.
+func (r *TextRenderer) writeChunks(sb *strings.Builder, chunks []Chunk, indentSize int) {
+	indent := strings.Repeat(" ", indentSize)
+	padding := 5
+	for _, l := range diffLines(chunks, r.context) {
+		switch {
+		case l.Skip:
+			sb.WriteString(indent + " ...\n")
+		case l.Action == Create:
+			sb.WriteString(fmt.Sprintf("%*s|%-*d ", padding, " ", padding, l.New) + r.color.Color(diffActionSymbol(Create)+fmt.Sprintf("%s%s\n", indent, l.Text)))
+		case l.Action == Delete:
+			sb.WriteString(fmt.Sprintf("%*d|%*s ", padding, l.Old, padding, " ") + r.color.Color(diffActionSymbol(Delete)+fmt.Sprintf("%s%s\n", indent, l.Text)))
+		default:
+			sb.WriteString(fmt.Sprintf("%*d|%-*d  %s%s\n", padding, l.Old, padding, l.New, indent, l.Text))
+		}
+	}
+}
+func diffActionSymbol(action Action) string {
+	switch action {
+	case Create:
+		return "[green]" + string(Create)
+	case Delete:
+		return "[red]" + string(Delete)
+	default:
+		return " "
+	}
+}
+func (r *TextRenderer) writeViolations(sb *strings.Builder, violations []Violation) {
+	sb.WriteString(r.color.Color("[bold]Policy violations:[reset]\n"))
+	for _, v := range violations {
+		location, message := v.location(), v.message()
+		sb.WriteString(r.color.Color(fmt.Sprintf("%s %s: %s: %s\n", severityColor(v.Rule.Severity), v.Rule.Name, location, message)))
+		if v.Line != "" {
+			sb.WriteString(fmt.Sprintf("    > %s\n", v.Line))
+		}
+	}
+}
+func severityColor(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "[red][error][reset]"
+	case SeverityWarning:
+		return "[yellow][warning][reset]"
+	default:
+		return "[info]"
+	}
+}
@@ -0,0 +1,266 @@
+package diff
+
+import (
+	"mime"
+	"net/textproto"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// Result is the difference between two user data blobs, see Diff.DiffBlobs.
+type Result struct {
+	// Parts holds the changed MIME parts, in document order.
+	Parts []*PartDiff
+	// Diagnostics holds the write_files entries, changed or not, whose content
+	// doesn't decode as declared, before and after.
+	Diagnostics []DecodeDiagnostic
+	// Violations holds the policy violations of the change. It is not set for
+	// the resources of a plan, see PlanResult.Violations.
+	Violations []Violation
+}
+
+// Empty reports whether nothing changed and there are no diagnostics or violations.
+func (r *Result) Empty() bool {
+	return r == nil || len(r.Parts) == 0 && len(r.Diagnostics) == 0 && len(r.Violations) == 0
+}
+
+// LineCounts returns the number of inserted and deleted lines of all parts.
+func (r *Result) LineCounts() (inserted, deleted int) {
+	if r == nil {
+		return 0, 0
+	}
+	for _, pd := range r.Parts {
+		i, d := pd.LineCounts()
+		inserted, deleted = inserted+i, deleted+d
+	}
+	return inserted, deleted
+}
+
+// fileCounts returns the number of added, removed and changed files: the
+// write_files entries of cloud-config parts, and any other part as a whole.
+func (r *Result) fileCounts() (added, removed, changed int) {
+	if r == nil {
+		return 0, 0, 0
+	}
+	count := func(action Action) {
+		switch action {
+		case Create:
+			added++
+		case Delete:
+			removed++
+		default:
+			changed++
+		}
+	}
+	for _, pd := range r.Parts {
+		if pd.Objects == nil {
+			count(pd.Action)
+			continue
+		}
+		for _, obj := range pd.Objects {
+			if obj.isFile() {
+				count(obj.Action)
+			}
+		}
+	}
+	return added, removed, changed
+}
+
+// PartDiff is the difference between two MIME parts of user data.
+// Parts are paired by their position in the multipart document.
+type PartDiff struct {
+	// Header of the part, from the after side unless the part is deleted.
+	Header textproto.MIMEHeader
+	Action Action
+	// Objects holds the write_files changes of a cloud-config part.
+	Objects []*Object
+	// Chunks holds the line changes of any other part.
+	Chunks []Chunk
+	// EncodingBefore and EncodingAfter are the encodings decoded to get the
+	// part, from the user data down to the part body.
+	EncodingBefore, EncodingAfter EncodingChain
+}
+
+// ContentType returns the Content-Type header of the part.
+func (p *PartDiff) ContentType() string {
+	return p.Header.Get("Content-Type")
+}
+
+// Filename returns the file name of the part from its Content-Disposition header, if any.
+func (p *PartDiff) Filename() string {
+	return partFilename(p.Header)
+}
+
+// Name returns the file name of the part, or its Content-Type if it has none.
+func (p *PartDiff) Name() string {
+	return partName(p.Header)
+}
+
+func partFilename(header textproto.MIMEHeader) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		return params["filename"]
+	}
+	return ""
+}
+
+// partName returns the file name of a MIME part, or its Content-Type if it has none.
+func partName(header textproto.MIMEHeader) string {
+	if name := partFilename(header); name != "" {
+		return name
+	}
+	return header.Get("Content-Type")
+}
+
+func (p *PartDiff) empty() bool {
+	return len(p.Objects) == 0 && len(p.Chunks) == 0
+}
+
+// LineCounts returns the number of inserted and deleted lines of the part.
+func (p *PartDiff) LineCounts() (inserted, deleted int) {
+	if p.Objects == nil {
+		return chunkLineCounts(p.Chunks)
+	}
+	for _, obj := range p.Objects {
+		i, d := obj.LineCounts()
+		inserted, deleted = inserted+i, deleted+d
+	}
+	return inserted, deleted
+}
+
+// Object is a changed write_files, users or groups entry or, with an empty
+// Path, the changed cloud-config keys compared besides them, e.g. ssh_authorized_keys.
+type Object struct {
+	// Path of the file
+	Path string
+	// Key is the cloud-config key of a users or groups entry, whose Path is
+	// then the name of the user or group; empty for write_files entries.
+	Key string
+	// Occurrence counts the entries with the same path before this one,
+	// it is always 0 when comparing effective content.
+	Occurrence int
+	Action     Action
+	// Fields holds the changed keys, sorted by key.
+	Fields []*Field
+	// EncodingBefore and EncodingAfter are the encodings decoded to get the content.
+	EncodingBefore, EncodingAfter EncodingChain
+}
+
+// Name returns the path of the file, "user <name>" or "group <name>" for users
+// and groups entries, or "cloud-config keys" for the changed cloud-config keys.
+func (o *Object) Name() string {
+	switch {
+	case o.Path == "":
+		return "cloud-config keys"
+	case o.Key != "":
+		return o.label() + " " + o.Path
+	}
+	return o.Path
+}
+
+// label returns the key naming the entry in output, e.g. "- user: deploy".
+func (o *Object) label() string {
+	switch o.Key {
+	case usersKey:
+		return "user"
+	case groupsKey:
+		return "group"
+	}
+	return "path"
+}
+
+// isFile reports whether o is a write_files entry.
+func (o *Object) isFile() bool {
+	return o.Key == "" && o.Path != ""
+}
+
+// LineCounts returns the number of inserted and deleted lines of the changed keys.
+func (o *Object) LineCounts() (inserted, deleted int) {
+	for _, field := range o.Fields {
+		i, d := chunkLineCounts(field.Chunks)
+		inserted, deleted = inserted+i, deleted+d
+	}
+	return inserted, deleted
+}
+
+// Field is a changed key of an Object.
+type Field struct {
+	Key    string
+	Action Action
+	Chunks []Chunk
+	// Block is set for multi-line values, rendered as a block under the key.
+	Block bool
+}
+
+// Chunk is a run of added and deleted lines followed by unchanged lines.
+type Chunk struct {
+	Added   []string
+	Deleted []string
+	Equal   []string
+}
+
+func chunkLineCounts(chunks []Chunk) (inserted, deleted int) {
+	for _, c := range chunks {
+		inserted += len(c.Added)
+		deleted += len(c.Deleted)
+	}
+	return inserted, deleted
+}
+func toChunks(chunks []diff.Chunk) []Chunk {
+	out := make([]Chunk, len(chunks))
+	for i, c := range chunks {
+		out[i] = Chunk(c)
+	}
+	return out
+}
+
+// PlanResult is the difference of user data of every supported resource in a plan, see Diff.DiffPlan.
+type PlanResult struct {
+	// Resources holds the changed resources, in plan order.
+	Resources []*ResourceDiff
+	// Violations holds the policy violations of all resources.
+	Violations []Violation
+}
+
+// ResourceDiff is the difference of the user data argument of a resource.
+type ResourceDiff struct {
+	Address string
+	Type    string
+	// Arg is the user data argument, e.g. user_data_base64
+	Arg string
+	// BeforeState and AfterState are set to "(known after apply)" or "(sensitive value)"
+	// when the value can't be decoded; Result is nil then.
+	BeforeState, AfterState string
+	Result                  *Result
+	// SchemaErrors holds the schema errors of cloud-config parts, before and after.
+	SchemaErrors []SchemaError
+	SizeBefore   UserDataSize
+	SizeAfter    UserDataSize
+	// SizeLimit is the provider limit for the resource type, 0 if unknown.
+	SizeLimit int
+}
+
+// Masked reports whether the value is unknown or sensitive, and was not decoded.
+func (r *ResourceDiff) Masked() bool {
+	return r.BeforeState != "" || r.AfterState != ""
+}
+
+// OverSizeLimit reports whether the after value is over the provider size limit.
+func (r *ResourceDiff) OverSizeLimit() bool {
+	return r.SizeLimit > 0 && r.SizeAfter.Payload() > r.SizeLimit
+}
+
+// states returns BeforeState and AfterState, "(decoded value)" for the side that is not masked.
+func (r *ResourceDiff) states() (before, after string) {
+	before, after = r.BeforeState, r.AfterState
+	if before == "" {
+		before = "(decoded value)"
+	}
+	if after == "" {
+		after = "(decoded value)"
+	}
+	return before, after
+}
+
+func (r *ResourceDiff) empty() bool {
+	return !r.Masked() && r.Result.Empty() && len(r.SchemaErrors) == 0 && !r.OverSizeLimit()
+}
@@ -0,0 +1,288 @@
+package diff
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfigSchemaJSON is a subset of cloud-init's published JSON schema for
+// cloud-config (schema-cloud-config-v1.json of cloud-init 24.4), not the
+// upstream file: write_files, users, groups, runcmd, bootcmd, packages,
+// chpasswd and a few more modules are defined, the other modules are only
+// listed, so their values are not checked. Top-level keys that are not
+// cloud-init modules are errors.
+//
+//go:embed cloud-config.schema.json
+var cloudConfigSchemaJSON []byte
+
+var cloudConfigSchema = mustParseSchema(cloudConfigSchemaJSON)
+
+// jsonSchema is the part of JSON schema draft-04 used by the bundled subset of cloud-init's schema.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+}
+
+// schemaTypes is the "type" keyword, either a type name or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// additionalProperties is the "additionalProperties" keyword, either a bool or a schema.
+type additionalProperties struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (a *additionalProperties) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(b, &a.schema)
+}
+
+func mustParseSchema(b []byte) *jsonSchema {
+	var s jsonSchema
+	if err := json.Unmarshal(b, &s); err != nil {
+		panic(fmt.Sprintf("invalid bundled schema: %v", err))
+	}
+	return &s
+}
+
+// SchemaError is a schema violation in a cloud-config part.
+type SchemaError struct {
+	// Side is "before" or "after".
+	Side string
+	// Part is the file name of the MIME part, or its Content-Type.
+	Part string
+	// Line in the part body, 0 if unknown.
+	Line int
+	// Path of the invalid value in the document, e.g. write_files.0
+	Path    string
+	Message string
+}
+
+func (e SchemaError) String() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+}
+
+// validateCloudConfig validates a cloud-config document against the bundled schema.
+func validateCloudConfig(body []byte) []SchemaError {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(body, &document); err != nil {
+		return []SchemaError{{Message: err.Error()}}
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	errs := cloudConfigSchema.validate(document.Content[0], cloudConfigSchema, "")
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return errs
+}
+
+// validate returns the errors of node against s, root holds the $defs referenced by s.
+func (root *jsonSchema) validate(node *yaml.Node, s *jsonSchema, path string) []SchemaError {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if s.Ref != "" {
+		ref, ok := root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+		if !ok {
+			return []SchemaError{{Line: node.Line, Path: path, Message: fmt.Sprintf("unresolved schema reference %s", s.Ref)}}
+		}
+		s = ref
+	}
+	if len(s.Type) > 0 && !s.Type.match(node) {
+		return []SchemaError{{Line: node.Line, Path: path, Message: fmt.Sprintf("%s is not of type %s", quoteNode(node), s.Type)}}
+	}
+	if len(s.Enum) > 0 && !inEnum(node, s.Enum) {
+		return []SchemaError{{Line: node.Line, Path: path, Message: fmt.Sprintf("%s is not one of %s", quoteNode(node), formatEnum(s.Enum))}}
+	}
+	if alternatives := append(append([]*jsonSchema{}, s.AnyOf...), s.OneOf...); len(alternatives) > 0 {
+		if errs := root.validateAlternatives(node, alternatives, path); len(errs) > 0 {
+			return errs
+		}
+	}
+	errs := make([]SchemaError, 0)
+	switch node.Kind {
+	case yaml.MappingNode:
+		present := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			key := keyNode.Value
+			present[key] = true
+			keyPath := joinSchemaPath(path, key)
+			if prop, ok := s.Properties[key]; ok {
+				errs = append(errs, root.validate(valueNode, prop, keyPath)...)
+			} else if s.AdditionalProperties != nil && !s.AdditionalProperties.allowed {
+				errs = append(errs, SchemaError{Line: keyNode.Line, Path: path, Message: fmt.Sprintf("Additional properties are not allowed ('%s' was unexpected)", key)})
+			} else if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+				errs = append(errs, root.validate(valueNode, s.AdditionalProperties.schema, keyPath)...)
+			}
+		}
+		for _, key := range s.Required {
+			if !present[key] {
+				errs = append(errs, SchemaError{Line: node.Line, Path: path, Message: fmt.Sprintf("'%s' is a required property", key)})
+			}
+		}
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for i, item := range node.Content {
+				errs = append(errs, root.validate(item, s.Items, joinSchemaPath(path, fmt.Sprint(i)))...)
+			}
+		}
+	}
+	return errs
+}
+
+// validateAlternatives validates node against anyOf/oneOf alternatives. If node
+// matches the type of only one alternative, that alternative's errors are returned,
+// they are more helpful than a generic mismatch.
+func (root *jsonSchema) validateAlternatives(node *yaml.Node, alternatives []*jsonSchema, path string) []SchemaError {
+	var typed []SchemaError
+	typedCount := 0
+	types := make([]string, 0)
+	for _, alt := range alternatives {
+		errs := root.validate(node, alt, path)
+		if len(errs) == 0 {
+			return nil
+		}
+		resolved := alt
+		if alt.Ref != "" {
+			resolved = root.Defs[strings.TrimPrefix(alt.Ref, "#/$defs/")]
+		}
+		if resolved == nil {
+			continue
+		}
+		types = append(types, resolved.Type...)
+		if len(resolved.Type) == 0 || resolved.Type.match(node) {
+			typed = errs
+			typedCount++
+		}
+	}
+	if typedCount == 1 {
+		return typed
+	}
+	return []SchemaError{{Line: node.Line, Path: path, Message: fmt.Sprintf("%s is not valid under any of the given schemas (%s)", quoteNode(node), strings.Join(types, ", "))}}
+}
+
+func (t schemaTypes) match(node *yaml.Node) bool {
+	actual := nodeType(node)
+	for _, name := range t {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+func (t schemaTypes) String() string {
+	quoted := make([]string, len(t))
+	for i, name := range t {
+		quoted[i] = "'" + name + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// yaml11Bools are the plain scalars YAML 1.1 reads as booleans but YAML 1.2,
+// and so yaml.v3, as strings. cloud-init loads cloud-config with PyYAML, a
+// YAML 1.1 parser, so `append: yes` is a boolean to it.
+var yaml11Bools = map[string]bool{
+	"yes": true, "Yes": true, "YES": true, "no": true, "No": true, "NO": true,
+	"on": true, "On": true, "ON": true, "off": true, "Off": true, "OFF": true,
+}
+
+// nodeType returns the JSON type of a YAML node, as cloud-init reads it.
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	if node.Style == 0 && yaml11Bools[node.Value] {
+		return "boolean"
+	}
+	switch node.ShortTag() {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+func inEnum(node *yaml.Node, enum []interface{}) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == node.Value {
+			return true
+		}
+	}
+	return false
+}
+func formatEnum(enum []interface{}) string {
+	quoted := make([]string, len(enum))
+	for i, v := range enum {
+		quoted[i] = fmt.Sprintf("'%v'", v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+func quoteNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	if nodeType(node) == "string" {
+		return "'" + node.Value + "'"
+	}
+	return node.Value
+}
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// validateParts validates the cloud-config parts in parts, side is "before" or "after".
+func validateParts(side string, parts []*part) []SchemaError {
+	results := make([]SchemaError, 0)
+	for _, p := range parts {
+		if !p.isYAML() {
+			continue
+		}
+		for _, e := range validateCloudConfig(p.body) {
+			e.Side, e.Part = side, partName(p.header)
+			results = append(results, e)
+		}
+	}
+	return results
+}
@@ -0,0 +1,79 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCloudConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		expect []string
+	}{
+		{"valid", `#cloud-config
+write_files:
+- path: /etc/motd
+  permissions: '0644'
+  encoding: b64
+  content: aGVsbG8K
+users:
+- default
+- name: alice
+  sudo: ALL=(ALL) NOPASSWD:ALL
+  ssh_authorized_keys: [ssh-ed25519 AAAA alice]
+runcmd:
+- [systemctl, enable, foo]
+- echo done
+ntp: {enabled: true}
+`, []string{}},
+		{"typo in module keys", `#cloud-config
+write_file:
+- path: /etc/motd
+runcmds:
+- echo done
+`, []string{
+			"line 2: Additional properties are not allowed ('write_file' was unexpected)",
+			"line 4: Additional properties are not allowed ('runcmds' was unexpected)",
+		}},
+		{"typo in write_files", `#cloud-config
+write_files:
+- path: /etc/motd
+  permisions: '0644'
+`, []string{"line 4: write_files.0: Additional properties are not allowed ('permisions' was unexpected)"}},
+		{"missing path and wrong types", `write_files:
+- content: hello
+  append: "yes"
+  encoding: gzip+base32
+`, []string{
+			"line 2: write_files.0: 'path' is a required property",
+			"line 3: write_files.0.append: 'yes' is not of type 'boolean'",
+			"line 4: write_files.0.encoding: 'gzip+base32' is not one of ['gz', 'gzip', 'gz+base64', 'gzip+base64', 'gz+b64', 'gzip+b64', 'b64', 'base64', 'text/plain']",
+		}},
+		{"yaml 1.1 booleans", `write_files:
+- path: /etc/motd
+  append: yes
+users:
+- name: bob
+  lock_passwd: on
+  no_create_home: No
+`, []string{}},
+		{"error inside alternative", `users:
+- name: bob
+  lock_passwd: nope
+`, []string{"line 3: users.0.lock_passwd: 'nope' is not of type 'boolean'"}},
+		{"no alternative matches", `runcmd:
+- {a: b}
+`, []string{"line 2: runcmd.0: object is not valid under any of the given schemas (string, array, null)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := make([]string, 0)
+			for _, e := range validateCloudConfig([]byte(tt.doc)) {
+				actual = append(actual, e.String())
+			}
+			assert.Equal(t, tt.expect, actual)
+		})
+	}
+}
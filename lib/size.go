@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// userDataSizeLimits is the maximum size of user data accepted by the provider,
+// for resource types in supportedResourceTypeArgs. The limit applies to the
+// payload, i.e. the value after base64 decoding (still compressed if it is gzipped).
+var userDataSizeLimits = map[string]int{
+	// EC2 rejects user data over 16 KB
+	"aws_instance":        16 << 10,
+	"aws_launch_template": 16 << 10,
+	// Azure custom_data is limited to 64 KB
+	"azurerm_linux_virtual_machine":                  64 << 10,
+	"azurerm_windows_virtual_machine":                64 << 10,
+	"azurerm_linux_virtual_machine_scale_set":        64 << 10,
+	"azurerm_windows_virtual_machine_scale_set":      64 << 10,
+	"azurerm_orchestrated_virtual_machine_scale_set": 64 << 10,
+	// GCE limits a metadata value, e.g. startup-script, to 256 KB
+	"google_compute_instance":          256 << 10,
+	"google_compute_instance_template": 256 << 10,
+}
+
+// UserDataSize holds the sizes in bytes of a user data value.
+type UserDataSize struct {
+	// Raw is the size of the fully decoded content.
+	Raw int
+	// Compressed is the size of the gzipped content: as sent if Gzipped is set, estimated otherwise.
+	Compressed int
+	// Base64 is the size of the base64 encoded value.
+	Base64  int
+	Gzipped bool
+}
+
+// Payload returns the size the provider stores, after base64 decoding.
+func (s UserDataSize) Payload() int {
+	if s.Gzipped {
+		return s.Compressed
+	}
+	return s.Raw
+}
+
+func measureUserData(value string) UserDataSize {
+	if value == "" {
+		return UserDataSize{}
+	}
+	decoded, err := base64Decode(value)
+	if err != nil {
+		// not base64, the value is sent as is
+		return UserDataSize{Raw: len(value), Compressed: gzipSize([]byte(value)), Base64: base64.StdEncoding.EncodedLen(len(value))}
+	}
+	size := UserDataSize{Base64: len(value), Compressed: len(decoded)}
+	raw, err := gunzipData(decoded)
+	size.Raw = len(raw)
+	size.Gzipped = err == nil
+	if !size.Gzipped {
+		size.Compressed = gzipSize(decoded)
+	}
+	return size
+}
+func gzipSize(data []byte) int {
+	compressed, _ := gzipData(data)
+	return len(compressed)
+}
+
+// sizes returns the sizes of user data before and after: the raw, gzip and
+// base64 sizes if all is set, otherwise the payload size, or "" if it didn't change.
+func (r *ResourceDiff) sizes(all bool) string {
+	if all {
+		return fmt.Sprintf("raw %s, gzip %s, base64 %s", formatSizeDelta(r.SizeBefore.Raw, r.SizeAfter.Raw),
+			formatSizeDelta(r.SizeBefore.Compressed, r.SizeAfter.Compressed), formatSizeDelta(r.SizeBefore.Base64, r.SizeAfter.Base64))
+	}
+	if r.SizeBefore.Payload() == r.SizeAfter.Payload() {
+		return ""
+	}
+	return "payload " + formatSizeDelta(r.SizeBefore.Payload(), r.SizeAfter.Payload())
+}
+
+func formatSizeDelta(before, after int) string {
+	return fmt.Sprintf("%s -> %s (%+d B)", formatBytes(before), formatBytes(after), after-before)
+}
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+}
+
+// SizeLimitError is returned when user data is over the provider size limit.
+type SizeLimitError struct {
+	// Addresses of the resources over the limit
+	Addresses []string
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("user data over the provider size limit: %s", strings.Join(e.Addresses, ", "))
+}
@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureUserData(t *testing.T) {
+	raw := strings.Repeat("echo hello\n", 100)
+	gzipped, _ := gzipData([]byte(raw))
+	tests := []struct {
+		name   string
+		value  string
+		expect UserDataSize
+	}{
+		{"empty", "", UserDataSize{}},
+		{"base64", base64Encode([]byte(raw)), UserDataSize{Raw: len(raw), Compressed: len(gzipped), Base64: len(base64Encode([]byte(raw)))}},
+		{"gzip base64", base64Encode(gzipped), UserDataSize{Raw: len(raw), Compressed: len(gzipped), Base64: len(base64Encode(gzipped)), Gzipped: true}},
+		{"plain", "#!/bin/sh\n" + raw, UserDataSize{Raw: len(raw) + 10, Compressed: gzipSize([]byte("#!/bin/sh\n" + raw)), Base64: len(base64Encode([]byte("#!/bin/sh\n" + raw)))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, measureUserData(tt.value))
+		})
+	}
+}
+
+func TestPlanJSON_SizeLimit(t *testing.T) {
+	noise := make([]byte, 24<<10)
+	rand.New(rand.NewSource(1)).Read(noise)
+	before, after := buildUserData("echo one"), buildUserData("echo "+base64Encode(noise))
+	d, _ := NewWithOptions(Options{NoColor: true, FailOnSizeLimit: true})
+	var buf bytes.Buffer
+	err := d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+		"before": map[string]interface{}{"user_data_base64": before},
+		"after":  map[string]interface{}{"user_data_base64": after},
+	})), &buf)
+	var sizeErr *SizeLimitError
+	assert.True(t, errors.As(err, &sizeErr))
+	assert.Equal(t, []string{"aws_instance.this"}, sizeErr.Addresses)
+	assert.Regexp(t, `\n! size: user_data_base64 is [0-9.]+ KiB, over the aws_instance limit of 16.0 KiB$`, buf.String())
+
+	// sensitive values are measured too
+	buf.Reset()
+	err = d.PlanJSON(strings.NewReader(buildPlan(t, map[string]interface{}{
+		"before":          map[string]interface{}{"user_data_base64": before},
+		"after":           map[string]interface{}{"user_data_base64": after},
+		"after_sensitive": true,
+	})), &buf)
+	assert.True(t, errors.As(err, &sizeErr))
+	assert.Regexp(t, `^@@ aws_instance.this\n~  user_data_base64: \(decoded value\) -> \(sensitive value\)\n! size: user_data_base64 is [0-9.]+ KiB`, buf.String())
+}
+
+func TestResourceDiff_Sizes(t *testing.T) {
+	rd := &ResourceDiff{SizeBefore: UserDataSize{Raw: 100, Compressed: 60, Base64: 80, Gzipped: true},
+		SizeAfter: UserDataSize{Raw: 120, Compressed: 70, Base64: 96, Gzipped: true}}
+	assert.Equal(t, "payload 60 B -> 70 B (+10 B)", rd.sizes(false))
+	assert.Equal(t, "raw 100 B -> 120 B (+20 B), gzip 60 B -> 70 B (+10 B), base64 80 B -> 96 B (+16 B)", rd.sizes(true))
+	rd.SizeAfter = rd.SizeBefore
+	assert.Equal(t, "", rd.sizes(false))
+}
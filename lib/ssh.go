@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"regexp"
+	"strings"
+)
+
+// fieldPattern matches the fields of an authorized_keys line.
+var fieldPattern = regexp.MustCompile(`\S+`)
+
+// describeAuthorizedKey returns an OpenSSH public key line of an
+// authorized_keys file as its type, SHA256 fingerprint and comment, followed by
+// its options if any, e.g. "ssh-ed25519 SHA256:... alice@laptop". It returns
+// false if line is not a public key.
+func describeAuthorizedKey(line string) (string, bool) {
+	// the offsets of the fields, separated by any whitespace as sshd does
+	fields := fieldPattern.FindAllStringIndex(line, -1)
+	for i := 0; i+1 < len(fields); i++ {
+		typ, blob := line[fields[i][0]:fields[i][1]], line[fields[i+1][0]:fields[i+1][1]]
+		key, err := base64.StdEncoding.DecodeString(blob)
+		if err != nil || keyType(key) != typ {
+			continue
+		}
+		sum := sha256.Sum256(key)
+		desc := typ + " SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+		if comment := strings.TrimSpace(line[fields[i+1][1]:]); comment != "" {
+			desc += " " + comment
+		}
+		if options := strings.TrimSpace(line[:fields[i][0]]); options != "" {
+			desc += " [options: " + options + "]"
+		}
+		return desc, true
+	}
+	return "", false
+}
+
+// keyType returns the type of a public key in the SSH wire format, the
+// string it starts with, "" if key is too short.
+func keyType(key []byte) string {
+	if len(key) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(key)
+	if uint64(len(key)-4) < uint64(n) {
+		return ""
+	}
+	return string(key[4 : 4+n])
+}
+
+// authorizedKeysLines returns the content of an authorized_keys file with each
+// public key described by describeAuthorizedKey, and blank lines dropped.
+func authorizedKeysLines(s string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if desc, ok := describeAuthorizedKey(line); ok {
+			line = desc
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
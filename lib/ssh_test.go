@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testAuthorizedKey returns an ssh-ed25519 public key of seed, and its fingerprint.
+func testAuthorizedKey(seed byte) (string, string) {
+	wire := func(b []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+	}
+	key := append(wire([]byte("ssh-ed25519")), wire([]byte(strings.Repeat(string(rune('A'+seed)), 32)))...)
+	sum := sha256.Sum256(key)
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(key), "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func TestDescribeAuthorizedKey(t *testing.T) {
+	key, fingerprint := testAuthorizedKey(0)
+	tests := []struct {
+		name   string
+		line   string
+		expect string
+		ok     bool
+	}{
+		{"key", key, "ssh-ed25519 " + fingerprint, true},
+		{"comment", key + " alice@laptop", "ssh-ed25519 " + fingerprint + " alice@laptop", true},
+		{"tab", strings.Replace(key, " ", "\t", 1) + "\talice@laptop", "ssh-ed25519 " + fingerprint + " alice@laptop", true},
+		{"spaces", strings.Replace(key, " ", "  ", 1) + "  alice@laptop", "ssh-ed25519 " + fingerprint + " alice@laptop", true},
+		{"options and tab", "no-pty\t" + strings.Replace(key, " ", "\t", 1), "ssh-ed25519 " + fingerprint + " [options: no-pty]", true},
+		{"options", `from="10.0.0.0/8",no-pty ` + key + " ci deploy", "ssh-ed25519 " + fingerprint + ` ci deploy [options: from="10.0.0.0/8",no-pty]`, true},
+		{"type mismatch", "ssh-rsa" + strings.TrimPrefix(key, "ssh-ed25519"), "", false},
+		{"not a key", "# keys of the ops team", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, ok := describeAuthorizedKey(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expect, desc)
+		})
+	}
+}
+
+func TestCompareYAML_AuthorizedKeys(t *testing.T) {
+	alice, aliceFP := testAuthorizedKey(0)
+	bob, bobFP := testAuthorizedKey(1)
+	before := "#cloud-config\nssh_authorized_keys:\n- " + alice + " alice\n" +
+		"users:\n- default\n- name: deploy\n  ssh_authorized_keys:\n  - " + alice + " alice\n" +
+		"write_files:\n- path: /home/ops/.ssh/authorized_keys\n  content: |\n    " + alice + " alice\n"
+	after := strings.ReplaceAll(before, alice+" alice", bob+" bob")
+
+	d, err := NewWithOptions(Options{NoColor: true})
+	assert.NoError(t, err)
+	expect := ` ssh_authorized_keys:
+    1|      -  ssh-ed25519 ` + aliceFP + ` alice
+     |1     +  ssh-ed25519 ` + bobFP + ` bob
+ - user: deploy
+-  ssh_authorized_keys: ssh-ed25519 ` + aliceFP + ` alice
++  ssh_authorized_keys: ssh-ed25519 ` + bobFP + ` bob
+ - path: /home/ops/.ssh/authorized_keys
+-  content: ssh-ed25519 ` + aliceFP + ` alice
++  content: ssh-ed25519 ` + bobFP + ` bob
+`
+	assert.Equal(t, expect, d.diffYAML(before, after))
+}
@@ -0,0 +1,164 @@
+package diff
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// unitExtensions are the extensions of systemd unit files, and of the
+// systemd-networkd files of the same format.
+var unitExtensions = map[string]bool{
+	".service": true, ".socket": true, ".timer": true, ".path": true, ".mount": true, ".automount": true,
+	".swap": true, ".target": true, ".slice": true, ".scope": true, ".network": true, ".netdev": true, ".link": true,
+}
+
+// isUnitFile reports whether p is a systemd unit file, or a drop-in of one,
+// e.g. /etc/systemd/system/app.service.d/override.conf
+func isUnitFile(p string) bool {
+	if unitExtensions[path.Ext(p)] {
+		return true
+	}
+	return path.Ext(p) == ".conf" && strings.HasSuffix(path.Dir(p), ".d") && strings.Contains(p, "systemd/")
+}
+
+// unitLines returns a systemd unit file as one line per directive, prefixed by
+// its section, e.g. "[Service] Restart=always", so a change reads as a change
+// of a directive of a section. Sections keep their order, directives are
+// sorted by name within their section; repeated directives such as
+// Environment= and ExecStartPre= keep their order, as they are ordered lists.
+// Comments, blank lines and line continuations are dropped.
+func unitLines(s string) string {
+	sections := make([]string, 0)
+	directives := make(map[string][]string)
+	keys := make(map[string][]string)
+	section := ""
+	add := func(key, line string) {
+		if _, ok := directives[section]; !ok {
+			sections = append(sections, section)
+		}
+		directives[section] = append(directives[section], line)
+		keys[section] = append(keys[section], key)
+	}
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(lines[i])
+		}
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line
+			continue
+		}
+		key := line
+		if i := strings.Index(line, "="); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			line = key + "=" + strings.TrimSpace(line[i+1:])
+		}
+		if section != "" {
+			line = section + " " + line
+		}
+		add(key, line)
+	}
+	out := make([]string, 0)
+	for _, section := range sections {
+		lines, sectionKeys := directives[section], keys[section]
+		order := make([]int, len(lines))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return sectionKeys[order[i]] < sectionKeys[order[j]]
+		})
+		for _, i := range order {
+			out = append(out, lines[i])
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// unitFields returns the changes between two unit files, as returned by
+// unitLines, one field per changed directive keyed by its section and name,
+// e.g. "[Service] ExecStart": changed, added or removed with its values.
+// The values of a repeated directive, e.g. ExecStartPre, are compared in order.
+func unitFields(before, after string) []*Field {
+	keysA, valuesA := unitDirectives(before)
+	keysB, valuesB := unitDirectives(after)
+	keys := keysA
+	for _, key := range keysB {
+		if _, ok := valuesA[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	fields := make([]*Field, 0)
+	for _, key := range keys {
+		a, b := valuesA[key], valuesB[key]
+		chunks := diff.DiffChunks(a, b)
+		if len(chunks) == 0 || len(chunks) == 1 && len(chunks[0].Added)+len(chunks[0].Deleted) == 0 {
+			continue
+		}
+		action := Update
+		switch {
+		case len(a) == 0:
+			action = Create
+		case len(b) == 0:
+			action = Delete
+		}
+		fields = append(fields, &Field{key, action, toChunks(chunks), len(a) > 1 || len(b) > 1})
+	}
+	return fields
+}
+
+// unitDirectives returns the directives of s, as returned by unitLines, in
+// order, and their values by directive.
+func unitDirectives(s string) ([]string, map[string][]string) {
+	keys := make([]string, 0)
+	values := make(map[string][]string)
+	for _, line := range strings.Split(s, "\n") {
+		if line == "" {
+			continue
+		}
+		key, value := line, ""
+		if i := strings.Index(line, "="); i >= 0 {
+			key, value = line[:i], line[i+1:]
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], value)
+	}
+	return keys, values
+}
+
+// isDirectiveKey reports whether key is the key of a field of a directive of a
+// unit file, see unitFields.
+func isDirectiveKey(key string) bool {
+	return strings.HasPrefix(key, "[")
+}
+
+// unitObjectFields returns the fields of a unit file, with its content field
+// replaced by the changes of its directives, see unitFields. before and after
+// are the keys of the unit file entry, nil if it is added or removed.
+func unitObjectFields(fields []*Field, before, after map[string]interface{}) []*Field {
+	content := func(attrs map[string]interface{}) string {
+		if v, ok := attrs["content"]; ok {
+			return toString(v)
+		}
+		return ""
+	}
+	out := make([]*Field, 0, len(fields))
+	for _, field := range fields {
+		if field.Key != "content" {
+			out = append(out, field)
+			continue
+		}
+		out = append(out, unitFields(content(before), content(after))...)
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnitFile(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect bool
+	}{
+		{"/etc/systemd/system/app.service", true},
+		{"/etc/systemd/system/backup.timer", true},
+		{"/etc/systemd/system/app.service.d/override.conf", true},
+		{"/etc/systemd/network/10-eth0.network", true},
+		{"/etc/nginx/conf.d/app.conf", false},
+		{"/etc/app/app.conf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expect, isUnitFile(tt.path))
+		})
+	}
+}
+
+func TestUnitLines(t *testing.T) {
+	unit := `# app
+[Unit]
+Description=App
+After=network.target
+
+[Service]
+Environment=A=1
+ExecStartPre=/bin/mkdir -p /var/lib/app
+ExecStart=/usr/bin/app \
+  --port 8080
+Environment=B=2
+ExecStartPre=/bin/chown app /var/lib/app
+Restart = always
+`
+	expect := `[Unit] After=network.target
+[Unit] Description=App
+[Service] Environment=A=1
+[Service] Environment=B=2
+[Service] ExecStart=/usr/bin/app  --port 8080
+[Service] ExecStartPre=/bin/mkdir -p /var/lib/app
+[Service] ExecStartPre=/bin/chown app /var/lib/app
+[Service] Restart=always`
+	assert.Equal(t, expect, unitLines(unit))
+}
+
+func TestUnitFields(t *testing.T) {
+	before := unitLines("[Service]\nExecStartPre=/bin/a\nExecStartPre=/bin/b\nExecStart=/usr/bin/app\nUser=app\nNice=5\n")
+	after := unitLines("[Service]\nUser=app\nExecStartPre=/bin/a\nExecStartPre=/bin/c\nExecStart=/usr/bin/app --debug\nRestart=always\n")
+	lines := make([]string, 0)
+	for _, field := range unitFields(before, after) {
+		for _, l := range diffLines(field.Chunks, 0) {
+			if !l.Skip {
+				lines = append(lines, string(field.Action)+" "+field.Key+" "+unifiedSymbol(l.Action)+l.Text)
+			}
+		}
+	}
+	assert.Equal(t, []string{
+		"~ [Service] ExecStart -/usr/bin/app",
+		"~ [Service] ExecStart +/usr/bin/app --debug",
+		"~ [Service] ExecStartPre -/bin/b",
+		"~ [Service] ExecStartPre +/bin/c",
+		"- [Service] Nice -5",
+		"+ [Service] Restart +always",
+	}, lines)
+}
+
+func TestCompareYAML_Unit(t *testing.T) {
+	config := func(unit string) string {
+		return "#cloud-config\nwrite_files:\n- path: /etc/systemd/system/app.service\n  content: |\n    " + strings.ReplaceAll(strings.TrimSuffix(unit, "\n"), "\n", "\n    ") + "\n"
+	}
+	before := config("[Service]\nExecStart=/usr/bin/app\nUser=app\n")
+	after := config("[Service]\nUser=app\nExecStart=/usr/bin/app --debug\nRestart=always\n")
+	d, err := NewWithOptions(Options{NoColor: true})
+	assert.NoError(t, err)
+	expect := ` - path: /etc/systemd/system/app.service
+-  [Service] ExecStart: /usr/bin/app
++  [Service] ExecStart: /usr/bin/app --debug
++  [Service] Restart: always
+`
+	assert.Equal(t, expect, d.diffYAML(before, after))
+}
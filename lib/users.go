@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of Object for users and groups entries.
+const (
+	usersKey  = "users"
+	groupsKey = "groups"
+)
+
+// sudoKey is the key of a user holding its sudo rules.
+const sudoKey = "sudo"
+
+// passwordKeys are the keys of a user whose value is never shown, only whether it changed.
+var passwordKeys = map[string]bool{"passwd": true, "hashed_passwd": true, "plain_text_passwd": true}
+
+// Values of password keys, see redactPasswords.
+const (
+	passwordUnchanged = "(redacted)"
+	passwordChanged   = "(redacted, changed)"
+)
+
+// compareIdentities returns the changes of users and groups, matched by name.
+func (d *Diff) compareIdentities(sc scope, s1, s2 string) []*Object {
+	objs := make([]*Object, 0)
+	for _, key := range []string{usersKey, groupsKey} {
+		m1, m2 := toIdentities(s1, key), toIdentities(s2, key)
+		redactPasswords(m1, m2)
+		for _, m := range []map[fileKey]map[string]interface{}{m1, m2} {
+			for _, attrs := range m {
+				for k, v := range attrs {
+					if k == sudoKey {
+						// sudo rules hold no secret, but their NOPASSWD: tag reads as one to the redactor
+						attrs[k] = d.dropIgnoredLines(sc, toString(v))
+						continue
+					}
+					attrs[k] = d.prepare(sc, toString(v))
+				}
+			}
+		}
+		for _, obj := range diffMap(m1, m2) {
+			obj.Key = key
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// toIdentities returns the entries of the users or groups key of cloud-config
+// s keyed by name, with the value of each of their keys as lines.
+func toIdentities(s, key string) map[fileKey]map[string]interface{} {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(s), &document); err != nil {
+		return nil
+	}
+	entries := make(map[fileKey]map[string]interface{})
+	occurrences := make(map[string]int)
+	add := func(name string, attrs map[string]interface{}) {
+		entries[fileKey{name, occurrences[name]}] = attrs
+		occurrences[name]++
+	}
+	for _, node := range document.Content {
+		value := getNodeByKey(node, key)
+		if value == nil {
+			continue
+		}
+		if key == groupsKey {
+			groupEntries(value, add)
+			continue
+		}
+		for _, user := range value.Content {
+			if user.Kind == yaml.ScalarNode {
+				// e.g. "default", the user of the distribution
+				add(user.Value, map[string]interface{}{})
+				continue
+			}
+			name, attrs := "(no name)", make(map[string]interface{})
+			for i := 0; i+1 < len(user.Content); i += 2 {
+				k := user.Content[i].Value
+				if k == "name" {
+					name = user.Content[i+1].Value
+					continue
+				}
+				attrs[k] = strings.Join(identityValueLines(k, user.Content[i+1]), "\n")
+			}
+			add(name, attrs)
+		}
+	}
+	return entries
+}
+
+// groupEntries calls add for each group of the groups key: a list of names or
+// of a name mapped to its members, a mapping of names to members, or a comma
+// separated list of names.
+func groupEntries(value *yaml.Node, add func(name string, attrs map[string]interface{})) {
+	addMapping := func(node *yaml.Node) {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			add(node.Content[i].Value, map[string]interface{}{"members": strings.Join(identityValueLines("members", node.Content[i+1]), "\n")})
+		}
+	}
+	switch value.Kind {
+	case yaml.ScalarNode:
+		for _, name := range splitList(value.Value) {
+			add(name, map[string]interface{}{})
+		}
+	case yaml.MappingNode:
+		addMapping(value)
+	case yaml.SequenceNode:
+		for _, group := range value.Content {
+			if group.Kind == yaml.MappingNode {
+				addMapping(group)
+			} else {
+				add(group.Value, map[string]interface{}{})
+			}
+		}
+	}
+}
+
+// identityValueLines returns the value of a key of a user or group as lines:
+// one per item of a list, group names and members sorted, public keys
+// described by describeAuthorizedKey.
+func identityValueLines(key string, value *yaml.Node) []string {
+	lines := make([]string, 0)
+	switch value.Kind {
+	case yaml.ScalarNode:
+		lines = append(lines, value.Value)
+		if key == "groups" || key == "members" {
+			lines = splitList(value.Value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				out, _ := yaml.Marshal(item)
+				lines = append(lines, strings.TrimSpace(string(out)))
+				continue
+			}
+			lines = append(lines, item.Value)
+		}
+	default:
+		out, _ := yaml.Marshal(value)
+		return strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	}
+	switch key {
+	case "groups", "members":
+		sort.Strings(lines)
+	case "ssh_authorized_keys":
+		for i, line := range lines {
+			if desc, ok := describeAuthorizedKey(line); ok {
+				lines[i] = desc
+			}
+		}
+	}
+	return lines
+}
+
+// splitList returns the items of a comma separated list, e.g. "wheel, docker".
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// redactPasswords replaces the password hashes of users in m1 and m2, before
+// and after, so they only show whether they changed.
+func redactPasswords(m1, m2 map[fileKey]map[string]interface{}) {
+	for key, attrs1 := range m1 {
+		attrs2 := m2[key]
+		for k := range passwordKeys {
+			v1, ok1 := attrs1[k]
+			v2, ok2 := attrs2[k]
+			if ok1 {
+				attrs1[k] = passwordUnchanged
+			}
+			if ok2 {
+				attrs2[k] = passwordUnchanged
+				if ok1 && v1 != v2 {
+					attrs2[k] = passwordChanged
+				}
+			}
+		}
+	}
+	for key, attrs2 := range m2 {
+		if _, ok := m1[key]; ok {
+			continue
+		}
+		for k := range passwordKeys {
+			if _, ok := attrs2[k]; ok {
+				attrs2[k] = passwordUnchanged
+			}
+		}
+	}
+}
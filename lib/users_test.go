@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareYAML_Users(t *testing.T) {
+	before := `#cloud-config
+users:
+- default
+- name: deploy
+  groups: docker, wheel
+  shell: /bin/bash
+  lock_passwd: true
+  passwd: $6$rounds=4096$salt$hash1
+- name: old
+groups:
+- admins: [alice]
+`
+	after := `#cloud-config
+users:
+- default
+- name: deploy
+  groups: [wheel, docker, adm]
+  shell: /bin/bash
+  lock_passwd: false
+  passwd: $6$rounds=4096$salt$hash2
+  sudo: ALL=(ALL) NOPASSWD:ALL
+- name: new
+  hashed_passwd: $6$rounds=4096$salt$hash3
+groups:
+- admins: [alice, bob]
+`
+	d, err := NewWithOptions(Options{NoColor: true})
+	assert.NoError(t, err)
+	expect := ` - user: deploy
+   groups:
+     |1     +    adm
+     ...
+-  lock_passwd: true
++  lock_passwd: false
+-  passwd: (redacted)
++  passwd: (redacted, changed)
++  sudo: ALL=(ALL) NOPASSWD:ALL
++- user: new
++  hashed_passwd: (redacted)
+-- user: old
+ - group: admins
+   members:
+     ...
+     |2     +    bob
+`
+	actual := d.diffYAML(before, after)
+	assert.Equal(t, expect, actual)
+	assert.NotContains(t, actual, "$6$")
+}
+
+func TestRedactPasswords(t *testing.T) {
+	key := fileKey{"deploy", 0}
+	tests := []struct {
+		name           string
+		before, after  map[string]interface{}
+		expectedBefore map[string]interface{}
+		expectedAfter  map[string]interface{}
+	}{
+		{"unchanged", map[string]interface{}{"passwd": "a"}, map[string]interface{}{"passwd": "a"},
+			map[string]interface{}{"passwd": passwordUnchanged}, map[string]interface{}{"passwd": passwordUnchanged}},
+		{"changed", map[string]interface{}{"passwd": "a"}, map[string]interface{}{"passwd": "b"},
+			map[string]interface{}{"passwd": passwordUnchanged}, map[string]interface{}{"passwd": passwordChanged}},
+		{"added", map[string]interface{}{}, map[string]interface{}{"hashed_passwd": "b"},
+			map[string]interface{}{}, map[string]interface{}{"hashed_passwd": passwordUnchanged}},
+		{"removed", map[string]interface{}{"plain_text_passwd": "a"}, map[string]interface{}{},
+			map[string]interface{}{"plain_text_passwd": passwordUnchanged}, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m1, m2 := map[fileKey]map[string]interface{}{key: tt.before}, map[fileKey]map[string]interface{}{key: tt.after}
+			redactPasswords(m1, m2)
+			assert.Equal(t, tt.expectedBefore, m1[key])
+			assert.Equal(t, tt.expectedAfter, m2[key])
+		})
+	}
+}
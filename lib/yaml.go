@@ -19,7 +19,7 @@ func decodeYAML(data []byte) []byte {
 	}
 	for _, schema := range schemas.([]interface{}) {
 		obj := schema.(map[string]interface{})
-		obj["content"], _ = decode(obj["content"].(string), obj["encoding"].(string))
+		obj["content"], _, _ = decode(obj["content"].(string), obj["encoding"].(string))
 	}
 	out, err := yaml.Marshal(v)
 	if err != nil {
@@ -51,7 +51,7 @@ func decodeContent(document *yaml.Node) {
 					encodingNode := getNodeByKey(seqNode.Content[i], "encoding")
 					contentNode := getNodeByKey(seqNode.Content[i], "content")
 					if encodingNode != nil && encodingNode.Kind == yaml.ScalarNode {
-						contentNode.Value, _ = decode(contentNode.Value, encodingNode.Value)
+						contentNode.Value, _, _ = decode(contentNode.Value, encodingNode.Value)
 					}
 				}
 			}